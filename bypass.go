@@ -0,0 +1,118 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package geo_filt
+
+import (
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/eterline/geo-filt/internal/service/bypass"
+	"github.com/eterline/geo-filt/internal/service/filter"
+)
+
+const defaultBypassHeader = "X-Geo-Bypass"
+
+// bypassExists - tests available bypass secret or keys
+func (c Config) bypassExists() bool {
+	return c.BypassSecret != "" || len(c.BypassKeys) > 0
+}
+
+// NewBypassVerifier - creates verifier of configured bypass tokens and keys
+func NewBypassVerifier(c *Config) (*bypass.Verifier, error) {
+	return bypass.NewVerifier(c.BypassSecret, c.BypassKeys)
+}
+
+/*
+bypassCredential - takes bypass credential of request.
+
+	Header and cookie are removed from request, so credential is not passed
+	to next handler. Cookie is used if header is empty.
+*/
+func (plugin *GeoFiltPlugin) bypassCredential(req *http.Request) string {
+	credential := req.Header.Get(plugin.bypassHeader)
+	req.Header.Del(plugin.bypassHeader)
+
+	if plugin.bypassCookie != "" {
+		if c, err := req.Cookie(plugin.bypassCookie); err == nil && credential == "" {
+			credential = c.Value
+		}
+		stripCookie(req.Header, plugin.bypassCookie)
+	}
+	return strings.TrimPrefix(credential, "Bearer ")
+}
+
+// stripCookie - removes cookie from request headers keeping other cookies as they are
+func stripCookie(h http.Header, name string) {
+	values := h.Values("Cookie")
+	if len(values) == 0 {
+		return
+	}
+
+	kept := make([]string, 0, len(values))
+	for _, v := range values {
+		parts := strings.Split(v, ";")
+		rest := parts[:0]
+		for _, part := range parts {
+			key, _, _ := strings.Cut(part, "=")
+			if strings.TrimSpace(key) != name {
+				rest = append(rest, part)
+			}
+		}
+		if v = strings.TrimSpace(strings.Join(rest, ";")); v != "" {
+			kept = append(kept, v)
+		}
+	}
+
+	h.Del("Cookie")
+	for _, v := range kept {
+		h.Add("Cookie", v)
+	}
+}
+
+// bypassSubject - returns subject of valid bypass credential
+func (plugin *GeoFiltPlugin) bypassSubject(req *http.Request, credential string) (string, bool) {
+	if credential == "" {
+		return "", false
+	}
+
+	// rejected credentials are logged as debug and sampled as decisions,
+	// so clients can not flood logs with them
+	subject, err := plugin.bypass.Verify(credential, time.Now())
+	if err != nil {
+		if plugin.log.Enabled(req.Context(), slog.LevelDebug) && plugin.logSample.Sample() {
+			plugin.log.Debug("bypass credential rejected",
+				"error", err.Error(),
+				"remote_addr", req.RemoteAddr,
+				"host", req.Host,
+				"path", req.URL.Path,
+			)
+		}
+		return "", false
+	}
+	return subject, true
+}
+
+// logBypass - writes record of denied request passed by bypass credential, bypasses are not sampled
+func (plugin *GeoFiltPlugin) logBypass(req *http.Request, ip netip.Addr, source, subject string, d filter.Decision) {
+	client := ""
+	if ip.IsValid() {
+		client = ip.String()
+	}
+
+	plugin.log.LogAttrs(req.Context(), slog.LevelInfo, "request bypassed",
+		slog.String("subject", subject),
+		slog.String("action", d.Action.String()),
+		slog.String("client_ip", client),
+		slog.String("source", source),
+		slog.String("country", d.Country),
+		slog.String("provider", d.Provider),
+		slog.String("method", req.Method),
+		slog.String("host", req.Host),
+		slog.String("path", req.URL.Path),
+	)
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/eterline/geo-filt/internal/adapter/ipmatch"
+)
+
+/*
+runCompile - compiles geo database into snapshot file.
+
+	Source is taken from config file and overridden by source flags.
+	Snapshot keeps every location, tags are selected when it is loaded.
+*/
+func runCompile(args []string) error {
+	fs := flag.NewFlagSet("compile", flag.ExitOnError)
+	configFile := fs.String("config", "", "plugin config file to take geo source from (YAML or JSON)")
+	codeFile := fs.String("codes", "", "locations CSV file")
+	geoFiles := fs.String("subnets", "", "comma separated subnets CSV files")
+	mmdbFile := fs.String("mmdb", "", "MaxMind DB file")
+	datFile := fs.String("dat", "", "v2ray/Xray geoip.dat file")
+	output := fs.String("o", "geo-filt.snap", "snapshot file to write")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: geo-filt compile [flags]\n\n"+
+			"Compiles CSV, MMDB or geoip.dat geo database into binary snapshot\n"+
+			"loaded by plugin 'snapshotFile' option.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	src := ipmatch.GeoSource{}
+	if *configFile != "" {
+		config, err := loadConfig(*configFile)
+		if err != nil {
+			return err
+		}
+		src = ipmatch.GeoSource{
+			CodeFile: config.CodeFile,
+			GeoFile:  config.GeoFile,
+			MMDBFile: config.MMDBFile,
+			DatFile:  config.DatFile,
+		}
+	}
+
+	if *codeFile != "" {
+		src.CodeFile = *codeFile
+	}
+	if *geoFiles != "" {
+		src.GeoFile = strings.Split(*geoFiles, ",")
+	}
+	if *mmdbFile != "" {
+		src.MMDBFile = *mmdbFile
+	}
+	if *datFile != "" {
+		src.DatFile = *datFile
+	}
+
+	if !src.Exists() {
+		return &exitError{code: 2, err: errors.New("geo source is not set: use -config, -mmdb, -dat or -codes with -subnets")}
+	}
+
+	info, err := ipmatch.CompileSnapshot(*output, src)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s: %s source, %d locations, %d IPv4 and %d IPv6 ranges\n",
+		*output, info.Source, info.Locations, info.Ranges4, info.Ranges6)
+	return nil
+}
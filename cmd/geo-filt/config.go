@@ -0,0 +1,85 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	geo_filt "github.com/eterline/geo-filt"
+	"github.com/eterline/geo-filt/internal/adapter/logger"
+	"gopkg.in/yaml.v3"
+)
+
+// loadConfig - reads plugin config from YAML or JSON file over plugin defaults
+func loadConfig(file string) (*geo_filt.Config, error) {
+	if file == "" {
+		return nil, errors.New("config file is not set")
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	config := geo_filt.CreateConfig()
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(config)
+	default:
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(config)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", file, err)
+	}
+
+	return config, nil
+}
+
+// loadFilter - builds filter chain of plugin config file once
+func loadFilter(file string, verbose bool) (*geo_filt.Filter, *geo_filt.Config, error) {
+	config, err := loadConfig(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := newFilter(config, verbose)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, config, nil
+}
+
+/*
+newFilter - builds filter chain of plugin config once.
+
+	Datasets are not watched for changes. Plugin logs are written
+	to stderr if verbose is set, otherwise dropped.
+*/
+func newFilter(config *geo_filt.Config, verbose bool) (*geo_filt.Filter, error) {
+	// datasets are loaded once, no need to watch them
+	config.ReloadInterval = ""
+
+	log := logger.Discard()
+	if verbose {
+		var err error
+		log, err = logger.New(os.Stderr, config.LogLevel, config.LogFormat)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return geo_filt.NewFilter(context.Background(), config, log, nil)
+}
@@ -0,0 +1,372 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/eterline/geo-filt/internal/adapter/ipmatch"
+	"github.com/eterline/geo-filt/pkg/netipuse"
+)
+
+// diff exit codes: datasets differ, invalid input
+const (
+	diffChanged = 1
+	diffInvalid = 2
+)
+
+/*
+runDiff - reports changes of selected countries between two geo database versions.
+
+	Exit code is 0 if selected networks are equal, 1 if they differ
+	and 2 on invalid arguments or databases.
+*/
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	tags := fs.String("tags", "", "comma separated tags to compare, every location if empty")
+	summary := fs.Bool("summary", false, "print counts only, without prefix lists")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: geo-filt diff [flags] <old> <new>\n\n"+
+			"Compares networks of selected countries between two geo database versions:\n"+
+			"added and removed prefixes per country, address counts per IP family and\n"+
+			"ranges moved from one country to another.\n"+
+			"Database is a directory of CSV files (locations*.csv and subnets CSV files)\n"+
+			"or .mmdb, .dat or .snap file (or directory with one of them).\n"+
+			"Exit code: 0 equal, 1 changed, 2 invalid input.\n\n")
+		fs.PrintDefaults()
+	}
+
+	// flags may follow database arguments
+	paths := make([]string, 0, 2)
+	for {
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			break
+		}
+		paths = append(paths, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(paths) != 2 {
+		fs.Usage()
+		return &exitError{code: diffInvalid}
+	}
+
+	var codes []string
+	if *tags != "" {
+		codes = strings.Split(*tags, ",")
+	}
+
+	old, err := loadDiffSide(paths[0], codes)
+	if err != nil {
+		return &exitError{code: diffInvalid, err: err}
+	}
+	cur, err := loadDiffSide(paths[1], codes)
+	if err != nil {
+		return &exitError{code: diffInvalid, err: err}
+	}
+
+	if printDiff(os.Stdout, old, cur, !*summary) {
+		return &exitError{code: diffChanged}
+	}
+	return nil
+}
+
+// diffSide - one database version of diff
+type diffSide struct {
+	path      string
+	src       ipmatch.GeoSource
+	selected  *ipmatch.GeoPool
+	countries map[string]*netipuse.PoolIP // every network of database by country
+	spans     []diffSpan                  // every network of database in ascending order
+}
+
+// diffSpan - range of database located to country
+type diffSpan struct {
+	r       netipuse.PoolRange
+	country string
+}
+
+func loadDiffSide(path string, codes []string) (*diffSide, error) {
+	src, err := geoSourceOfPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	gi, err := ipmatch.NewGeoIndex(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	gp, err := gi.SelectAll()
+	if len(codes) > 0 {
+		gp, err = gi.Select(codes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ds := &diffSide{
+		path:     path,
+		src:      src,
+		selected: gp,
+		spans:    make([]diffSpan, 0, gi.Len()),
+	}
+
+	builders := map[string]*netipuse.PoolIPBuilder{}
+	gi.All(func(r netipuse.PoolRange, g ipmatch.Geoname) bool {
+		c := countryOf(g)
+		b, ok := builders[c]
+		if !ok {
+			b = &netipuse.PoolIPBuilder{}
+			builders[c] = b
+		}
+		b.AddRange(r)
+		ds.spans = append(ds.spans, diffSpan{r: r, country: c})
+		return true
+	})
+
+	ds.countries = make(map[string]*netipuse.PoolIP, len(builders))
+	for c, b := range builders {
+		if ds.countries[c], err = b.PoolIP(); err != nil {
+			return nil, err
+		}
+	}
+	return ds, nil
+}
+
+// countryOf - returns country label of location
+func countryOf(g ipmatch.Geoname) string {
+	switch {
+	case g.CountryCode != "":
+		return strings.ToUpper(g.CountryCode)
+	case g.ContinentCode != "":
+		return "continent:" + strings.ToUpper(g.ContinentCode)
+	}
+	return "unknown"
+}
+
+// selectedCountries - returns countries of selected locations
+func (ds *diffSide) selectedCountries() []string {
+	ret := make([]string, 0, len(ds.selected.Sets))
+	for _, set := range ds.selected.Sets {
+		ret = append(ret, countryOf(set.Geoname))
+	}
+	return ret
+}
+
+// country - returns every network of country, empty pool if country is not in database
+func (ds *diffSide) country(c string) *netipuse.PoolIP {
+	if pool, ok := ds.countries[c]; ok {
+		return pool
+	}
+	return &netipuse.PoolIP{}
+}
+
+// printDiff - writes diff report and reports whether selected networks changed
+func printDiff(w io.Writer, old, cur *diffSide, prefixes bool) bool {
+	fmt.Fprintf(w, "old: %s (%s)\nnew: %s (%s)\n\n", old.path, old.src.Name(), cur.path, cur.src.Name())
+
+	changed := false
+	countries := uniqueSorted(append(old.selectedCountries(), cur.selectedCountries()...))
+	moves := diffMoves(old, cur, countries)
+
+	for _, c := range countries {
+		oldPool, curPool := old.country(c), cur.country(c)
+		added := curPool.Difference(oldPool)
+		removed := oldPool.Difference(curPool)
+
+		if added.IsEmpty() && removed.IsEmpty() {
+			fmt.Fprintf(w, "%s: unchanged, %s\n", c, formatSize(curPool))
+			continue
+		}
+		changed = true
+		fmt.Fprintf(w, "%s: %s -> %s\n", c, formatSize(oldPool), formatSize(curPool))
+		printPrefixes(w, "added", "+", added, prefixes)
+		printPrefixes(w, "removed", "-", removed, prefixes)
+	}
+
+	oldAll, curAll := old.selected.Pool, cur.selected.Pool
+	added, removed := curAll.Difference(oldAll), oldAll.Difference(curAll)
+
+	fmt.Fprintf(w, "\ntotal: %s -> %s\n", formatSize(oldAll), formatSize(curAll))
+	fmt.Fprintf(w, "  added:   %d prefixes, %s\n", countPrefixes(added), formatSize(added))
+	fmt.Fprintf(w, "  removed: %d prefixes, %s\n", countPrefixes(removed), formatSize(removed))
+
+	if len(moves) > 0 {
+		keys := make([][2]string, 0, len(moves))
+		for key := range moves {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if keys[i][0] != keys[j][0] {
+				return keys[i][0] < keys[j][0]
+			}
+			return keys[i][1] < keys[j][1]
+		})
+
+		fmt.Fprintf(w, "\nmoved:\n")
+		for _, key := range keys {
+			pool := moves[key]
+			fmt.Fprintf(w, "  %s -> %s: %d prefixes, %s\n", key[0], key[1], countPrefixes(pool), formatSize(pool))
+			if prefixes {
+				pool.AllPrefixes(func(p netip.Prefix) bool {
+					fmt.Fprintf(w, "    %s\n", p)
+					return true
+				})
+			}
+		}
+	}
+
+	return changed || !added.IsEmpty() || !removed.IsEmpty()
+}
+
+/*
+diffMoves - returns ranges located to other country in new database by old and new country.
+
+	Ranges of both databases are walked once in ascending order,
+	only moves from or to selected countries are kept.
+*/
+func diffMoves(old, cur *diffSide, countries []string) map[[2]string]*netipuse.PoolIP {
+	selected := make(map[string]bool, len(countries))
+	for _, c := range countries {
+		selected[c] = true
+	}
+
+	builders := map[[2]string]*netipuse.PoolIPBuilder{}
+	i, j := 0, 0
+	for i < len(old.spans) && j < len(cur.spans) {
+		a, b := old.spans[i], cur.spans[j]
+
+		from, to := a.r.From(), a.r.To()
+		if from.Less(b.r.From()) {
+			from = b.r.From()
+		}
+		if b.r.To().Less(to) {
+			to = b.r.To()
+		}
+
+		if !to.Less(from) && a.country != b.country && (selected[a.country] || selected[b.country]) {
+			key := [2]string{a.country, b.country}
+			pb, ok := builders[key]
+			if !ok {
+				pb = &netipuse.PoolIPBuilder{}
+				builders[key] = pb
+			}
+			pb.AddRange(netipuse.PoolRangeFrom(from, to))
+		}
+
+		if a.r.To().Less(b.r.To()) {
+			i++
+		} else {
+			j++
+		}
+	}
+
+	moves := make(map[[2]string]*netipuse.PoolIP, len(builders))
+	for key, pb := range builders {
+		moves[key], _ = pb.PoolIP()
+	}
+	return moves
+}
+
+func printPrefixes(w io.Writer, title, mark string, pool *netipuse.PoolIP, prefixes bool) {
+	if pool.IsEmpty() {
+		return
+	}
+	fmt.Fprintf(w, "  %s: %d prefixes, %s\n", title, countPrefixes(pool), formatSize(pool))
+	if !prefixes {
+		return
+	}
+	pool.AllPrefixes(func(p netip.Prefix) bool {
+		fmt.Fprintf(w, "    %s %s\n", mark, p)
+		return true
+	})
+}
+
+func countPrefixes(pool *netipuse.PoolIP) int {
+	n := 0
+	pool.AllPrefixes(func(netip.Prefix) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// formatSize - returns address counts of pool per IP family
+func formatSize(pool *netipuse.PoolIP) string {
+	ipv4, ipv6 := pool.Size()
+	return fmt.Sprintf("IPv4 %d, IPv6 %s", ipv4, ipv6)
+}
+
+func uniqueSorted(ss []string) []string {
+	sort.Strings(ss)
+	ret := ss[:0]
+	for i, s := range ss {
+		if i == 0 || s != ss[i-1] {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+/*
+geoSourceOfPath - returns geo source of database file or directory.
+
+	Files are recognized by extension: .snap, .mmdb, .dat.
+	Directory is searched for one of them, then for CSV files:
+	file named locations*.csv is codes file, other CSV files are subnets.
+*/
+func geoSourceOfPath(path string) (ipmatch.GeoSource, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return ipmatch.GeoSource{}, err
+	}
+
+	files := []string{path}
+	if st.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return ipmatch.GeoSource{}, err
+		}
+		files = files[:0]
+		for _, e := range entries {
+			if !e.IsDir() {
+				files = append(files, filepath.Join(path, e.Name()))
+			}
+		}
+	}
+
+	src := ipmatch.GeoSource{}
+	for _, file := range files {
+		name := strings.ToLower(filepath.Base(file))
+		switch filepath.Ext(name) {
+		case ".snap":
+			src.SnapshotFile = file
+		case ".mmdb":
+			src.MMDBFile = file
+		case ".dat":
+			src.DatFile = file
+		case ".csv":
+			if strings.HasPrefix(name, "location") {
+				src.CodeFile = file
+			} else {
+				src.GeoFile = append(src.GeoFile, file)
+			}
+		}
+	}
+
+	if !src.Exists() {
+		return src, errors.New(path + ": no geo database found: expected .snap, .mmdb, .dat file or locations and subnets CSV files")
+	}
+	return src, nil
+}
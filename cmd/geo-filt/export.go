@@ -0,0 +1,357 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+
+	geo_filt "github.com/eterline/geo-filt"
+	"github.com/eterline/geo-filt/internal/service/filter"
+	"github.com/eterline/geo-filt/pkg/netipuse"
+)
+
+// poolProvider - provider able to return every network it matches
+type poolProvider interface {
+	Pool() *netipuse.PoolIP
+}
+
+/*
+policySets - networks of filter decisions.
+
+	Allow and deny sets are disjoint: network of several rules
+	belongs to set of the rule with highest precedence,
+	so firewall rules may be applied in any order.
+*/
+type policySets struct {
+	allow, deny   *netipuse.PoolIP
+	defaultAction filter.Action
+}
+
+// newPolicySets - resolves rules of filter into allow and deny sets
+func newPolicySets(f *geo_filt.Filter) (*policySets, error) {
+	ps := &policySets{
+		allow:         &netipuse.PoolIP{},
+		deny:          &netipuse.PoolIP{},
+		defaultAction: f.DefaultAction(),
+	}
+
+	decided := &netipuse.PoolIP{}
+	for _, r := range f.Rules() {
+		pp, ok := r.Provider.(poolProvider)
+		if !ok {
+			return nil, fmt.Errorf("provider %s can not be exported: networks are unknown", r.Provider.Provider())
+		}
+
+		pool := pp.Pool()
+		eff := pool.Difference(decided)
+		if r.Action == filter.ActionAllow {
+			ps.allow = ps.allow.Union(eff)
+		} else {
+			ps.deny = ps.deny.Union(eff)
+		}
+		decided = decided.Union(pool)
+	}
+
+	return ps, nil
+}
+
+// familyPrefixes - returns minimal prefix cover of pool split by IP family
+func familyPrefixes(pool *netipuse.PoolIP) (v4, v6 []netip.Prefix) {
+	pool.AllPrefixes(func(p netip.Prefix) bool {
+		if p.Addr().Is4() {
+			v4 = append(v4, p)
+		} else {
+			v6 = append(v6, p)
+		}
+		return true
+	})
+	return v4, v6
+}
+
+// allowed - returns every network passed by filter
+func (ps *policySets) allowed() *netipuse.PoolIP {
+	if ps.defaultAction == filter.ActionAllow {
+		return complement(ps.deny)
+	}
+	return ps.allow
+}
+
+// denied - returns every network rejected by filter
+func (ps *policySets) denied() *netipuse.PoolIP {
+	if ps.defaultAction == filter.ActionDeny {
+		return complement(ps.allow)
+	}
+	return ps.deny
+}
+
+func complement(pool *netipuse.PoolIP) *netipuse.PoolIP {
+	b := netipuse.PoolIPBuilder{}
+	b.AddSet(pool)
+	b.Complement()
+	ret, _ := b.PoolIP()
+	return ret
+}
+
+// exportSet - named prefix list of one action and IP family
+type exportSet struct {
+	name     string
+	action   filter.Action
+	ipv6     bool
+	prefixes []netip.Prefix
+}
+
+// exportSets - returns sets of policy in firewall rule order: deny sets first
+func (ps *policySets) exportSets(name string) []exportSet {
+	allow4, allow6 := familyPrefixes(ps.allow)
+	deny4, deny6 := familyPrefixes(ps.deny)
+	return []exportSet{
+		{name: name + "_deny4", action: filter.ActionDeny, prefixes: deny4},
+		{name: name + "_deny6", action: filter.ActionDeny, ipv6: true, prefixes: deny6},
+		{name: name + "_allow4", action: filter.ActionAllow, prefixes: allow4},
+		{name: name + "_allow6", action: filter.ActionAllow, ipv6: true, prefixes: allow6},
+	}
+}
+
+// exportOptions - output options of export formats
+type exportOptions struct {
+	name   string // name of table, sets, chain or variable
+	denied bool   // list denied networks instead of allowed by list formats
+}
+
+// exportWriter - writes policy in output format
+type exportWriter func(w io.Writer, opt exportOptions, ps *policySets) error
+
+// exportFormat - output format with default name of its objects
+type exportFormat struct {
+	write exportWriter
+	name  string
+}
+
+var exportFormats = map[string]exportFormat{
+	"nftables": {write: writeNftables, name: "geofilt"},
+	"ipset":    {write: writeIpset, name: "geofilt"},
+	"iptables": {name: "GEOFILT", write: func(w io.Writer, opt exportOptions, ps *policySets) error {
+		return writeIptables(w, opt.name, ps, false)
+	}},
+	"ip6tables": {name: "GEOFILT", write: func(w io.Writer, opt exportOptions, ps *policySets) error {
+		return writeIptables(w, opt.name, ps, true)
+	}},
+	"nginx":       {write: writeNginx, name: "geo_allowed"},
+	"haproxy-map": {write: writeHAProxyMap},
+	"haproxy-acl": {write: writeHAProxyACL},
+	"apache":      {write: writeApache},
+	"cidr":        {write: writeCIDR},
+}
+
+func exportFormatNames() string {
+	names := make([]string, 0, len(exportFormats))
+	for name := range exportFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+/*
+runExport - writes networks of configured filter as firewall or proxy rules.
+
+	Networks are resolved with the same precedence as plugin does,
+	so firewall or proxy denies exactly the IPs plugin denies.
+*/
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	configFile := fs.String("config", "geo-filt.yaml", "plugin config file (YAML or JSON)")
+	format := fs.String("format", "nftables", "output format: "+exportFormatNames())
+	name := fs.String("name", "", "name of nftables table, ipset sets, iptables chain or nginx variable (default geofilt, GEOFILT, geo_allowed)")
+	tags := fs.String("tags", "", "comma separated tags overriding config 'tags'")
+	denied := fs.Bool("denied", false, "list denied networks instead of allowed (cidr and haproxy-acl formats)")
+	output := fs.String("o", "-", "file to write, '-' for stdout")
+	verbose := fs.Bool("v", false, "print plugin logs to stderr")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: geo-filt export [flags]\n\n"+
+			"Builds networks of configured filter and writes them as nftables sets,\n"+
+			"ipset restore script, iptables-restore rules, nginx geo block, HAProxy map or ACL,\n"+
+			"Apache 'Require ip' include or plain CIDR list of allowed networks.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	ef, ok := exportFormats[*format]
+	if !ok {
+		return &exitError{code: 2, err: fmt.Errorf("unknown format %q, expected one of: %s", *format, exportFormatNames())}
+	}
+
+	if *name == "" {
+		*name = ef.name
+	}
+
+	config, err := loadConfig(*configFile)
+	if err != nil {
+		return &exitError{code: 2, err: err}
+	}
+	if *tags != "" {
+		config.Tags = strings.Split(*tags, ",")
+	}
+
+	f, err := newFilter(config, *verbose)
+	if err != nil {
+		return &exitError{code: 2, err: err}
+	}
+	if !config.Enabled {
+		fmt.Fprintln(os.Stderr, "geo-filt export: plugin is disabled in config, exported rules are not used by plugin")
+	}
+
+	ps, err := newPolicySets(f)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "-" && *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	bw := bufio.NewWriter(w)
+	opt := exportOptions{name: *name, denied: *denied}
+	if err := ef.write(bw, opt, ps); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+/*
+writeNftables - writes nftables script of inet table with interval sets.
+
+	Chain is named as table and is not hooked: it is jumped to
+	from base chain of the same table defined by user.
+*/
+func writeNftables(w io.Writer, opt exportOptions, ps *policySets) error {
+	name := opt.name
+	sets := ps.exportSets(name)
+
+	fmt.Fprintf(w, "#!/usr/sbin/nft -f\n")
+	fmt.Fprintf(w, "# generated by geo-filt export, default action: %s\n\n", ps.defaultAction)
+
+	// declare table before delete to replace it atomically on every load
+	fmt.Fprintf(w, "table inet %s\ndelete table inet %s\n\n", name, name)
+	fmt.Fprintf(w, "table inet %s {\n", name)
+
+	for _, set := range sets {
+		typ := "ipv4_addr"
+		if set.ipv6 {
+			typ = "ipv6_addr"
+		}
+		fmt.Fprintf(w, "\tset %s {\n\t\ttype %s\n\t\tflags interval\n", set.name, typ)
+		if len(set.prefixes) > 0 {
+			fmt.Fprintf(w, "\t\telements = {\n")
+			for i, p := range set.prefixes {
+				sep := ","
+				if i == len(set.prefixes)-1 {
+					sep = ""
+				}
+				fmt.Fprintf(w, "\t\t\t%s%s\n", p, sep)
+			}
+			fmt.Fprintf(w, "\t\t}\n")
+		}
+		fmt.Fprintf(w, "\t}\n\n")
+	}
+
+	fmt.Fprintf(w, "\tchain %s {\n", name)
+	for _, set := range sets {
+		if len(set.prefixes) == 0 {
+			continue
+		}
+		family := "ip"
+		if set.ipv6 {
+			family = "ip6"
+		}
+		fmt.Fprintf(w, "\t\t%s saddr @%s %s\n", family, set.name, nftVerdict(set.action))
+	}
+	fmt.Fprintf(w, "\t\t%s\n", nftVerdict(ps.defaultAction))
+	fmt.Fprintf(w, "\t}\n}\n")
+
+	return nil
+}
+
+func nftVerdict(a filter.Action) string {
+	if a == filter.ActionAllow {
+		return "return"
+	}
+	return "drop"
+}
+
+/*
+writeIpset - writes 'ipset restore' script of hash:net sets.
+
+	Sets are created if missing and flushed, so script may be reloaded.
+	IPv4 and IPv6 networks are in separate sets of each action.
+*/
+func writeIpset(w io.Writer, opt exportOptions, ps *policySets) error {
+	fmt.Fprintf(w, "# generated by geo-filt export, default action: %s\n", ps.defaultAction)
+	fmt.Fprintf(w, "# load with: ipset restore -exist < file\n")
+
+	for _, set := range ps.exportSets(opt.name) {
+		family := "inet"
+		if set.ipv6 {
+			family = "inet6"
+		}
+		maxelem := 65536
+		for maxelem < len(set.prefixes) {
+			maxelem *= 2
+		}
+
+		fmt.Fprintf(w, "\ncreate %s hash:net family %s maxelem %d\n", set.name, family, maxelem)
+		fmt.Fprintf(w, "flush %s\n", set.name)
+		for _, p := range set.prefixes {
+			fmt.Fprintf(w, "add %s %s\n", set.name, p)
+		}
+	}
+
+	return nil
+}
+
+/*
+writeIptables - writes iptables-restore rules of chain in filter table.
+
+	Rules of one IP family are written: IPv4 for iptables,
+	IPv6 for ip6tables. Chain is not hooked, jump to it
+	from INPUT or FORWARD chain. Load with --noflush to keep other chains.
+*/
+func writeIptables(w io.Writer, chain string, ps *policySets, ipv6 bool) error {
+	fmt.Fprintf(w, "# generated by geo-filt export, default action: %s\n", ps.defaultAction)
+	fmt.Fprintf(w, "*filter\n:%s - [0:0]\n-F %s\n", chain, chain)
+
+	for _, set := range ps.exportSets(chain) {
+		if set.ipv6 != ipv6 {
+			continue
+		}
+		for _, p := range set.prefixes {
+			fmt.Fprintf(w, "-A %s -s %s -j %s\n", chain, p, iptablesTarget(set.action))
+		}
+	}
+	fmt.Fprintf(w, "-A %s -j %s\n", chain, iptablesTarget(ps.defaultAction))
+	fmt.Fprintf(w, "COMMIT\n")
+
+	return nil
+}
+
+func iptablesTarget(a filter.Action) string {
+	if a == filter.ActionAllow {
+		return "RETURN"
+	}
+	return "DROP"
+}
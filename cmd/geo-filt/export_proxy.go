@@ -0,0 +1,153 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+
+	"github.com/eterline/geo-filt/internal/service/filter"
+	"github.com/eterline/geo-filt/pkg/netipuse"
+)
+
+/*
+writeNginx - writes nginx geo block setting variable to 1 for allowed IPs.
+
+	Networks of allow and deny sets are disjoint, so longest prefix
+	match of geo module gives the plugin decision.
+	Include it into http context and reject requests with variable 0:
+	  if ($geo_allowed = 0) { return 403; }
+*/
+func writeNginx(w io.Writer, opt exportOptions, ps *policySets) error {
+	fmt.Fprintf(w, "# generated by geo-filt export, default action: %s\n", ps.defaultAction)
+	fmt.Fprintf(w, "geo $%s {\n", opt.name)
+	fmt.Fprintf(w, "\tdefault %s;\n", nginxValue(ps.defaultAction))
+
+	for _, set := range ps.exportSets(opt.name) {
+		for _, p := range set.prefixes {
+			fmt.Fprintf(w, "\t%s %s;\n", p, nginxValue(set.action))
+		}
+	}
+	fmt.Fprintf(w, "}\n")
+
+	return nil
+}
+
+func nginxValue(a filter.Action) string {
+	if a == filter.ActionAllow {
+		return "1"
+	}
+	return "0"
+}
+
+/*
+writeHAProxyMap - writes HAProxy map file of networks to action.
+
+	Default action is given to map_ip converter for unmatched IPs:
+	  http-request deny if { src,map_ip(/etc/haproxy/geofilt.map,deny) -m str deny }
+*/
+func writeHAProxyMap(w io.Writer, opt exportOptions, ps *policySets) error {
+	fmt.Fprintf(w, "# generated by geo-filt export, default action: %s\n", ps.defaultAction)
+	fmt.Fprintf(w, "# http-request deny if { src,map_ip(<this file>,%s) -m str deny }\n", ps.defaultAction)
+
+	for _, set := range ps.exportSets(opt.name) {
+		for _, p := range set.prefixes {
+			fmt.Fprintf(w, "%s %s\n", p, set.action)
+		}
+	}
+
+	return nil
+}
+
+/*
+writeHAProxyACL - writes HAProxy ACL file of allowed or denied networks.
+
+	Default action is resolved into the list, use it as:
+	  http-request deny unless { src -f /etc/haproxy/geofilt.acl }
+	or with denied networks:
+	  http-request deny if { src -f /etc/haproxy/geofilt.acl }
+*/
+func writeHAProxyACL(w io.Writer, opt exportOptions, ps *policySets) error {
+	fmt.Fprintf(w, "# generated by geo-filt export, default action: %s\n", ps.defaultAction)
+	if opt.denied {
+		fmt.Fprintf(w, "# http-request deny if { src -f <this file> }\n")
+	} else {
+		fmt.Fprintf(w, "# http-request deny unless { src -f <this file> }\n")
+	}
+
+	return writePrefixes(w, opt.listed(ps))
+}
+
+/*
+writeApache - writes Apache authorization include of plugin decision.
+
+	Allowed networks are listed if default action is deny,
+	denied networks otherwise, so list stays as short as plugin config.
+	Include it into <Directory>, <Location> or virtual host context.
+*/
+func writeApache(w io.Writer, opt exportOptions, ps *policySets) error {
+	fmt.Fprintf(w, "# generated by geo-filt export, default action: %s\n", ps.defaultAction)
+
+	if ps.defaultAction == filter.ActionDeny {
+		fmt.Fprintf(w, "<RequireAny>\n")
+		if ps.allow.IsEmpty() {
+			// block without directives is rejected by Apache
+			fmt.Fprintf(w, "\tRequire all denied\n")
+		}
+		writeApacheRequire(w, "Require ip", ps.allow)
+		fmt.Fprintf(w, "</RequireAny>\n")
+		return nil
+	}
+
+	fmt.Fprintf(w, "<RequireAll>\n\tRequire all granted\n")
+	writeApacheRequire(w, "Require not ip", ps.deny)
+	fmt.Fprintf(w, "</RequireAll>\n")
+	return nil
+}
+
+// apacheLinePrefixes - count of networks of one Require directive
+const apacheLinePrefixes = 32
+
+func writeApacheRequire(w io.Writer, directive string, pool *netipuse.PoolIP) {
+	n := 0
+	pool.AllPrefixes(func(p netip.Prefix) bool {
+		switch {
+		case n == 0:
+			fmt.Fprintf(w, "\t%s %s", directive, p)
+		case n%apacheLinePrefixes == 0:
+			fmt.Fprintf(w, "\n\t%s %s", directive, p)
+		default:
+			fmt.Fprintf(w, " %s", p)
+		}
+		n++
+		return true
+	})
+	if n > 0 {
+		fmt.Fprintln(w)
+	}
+}
+
+// writeCIDR - writes newline separated list of allowed or denied networks
+func writeCIDR(w io.Writer, opt exportOptions, ps *policySets) error {
+	return writePrefixes(w, opt.listed(ps))
+}
+
+// listed - returns networks of list formats
+func (opt exportOptions) listed(ps *policySets) *netipuse.PoolIP {
+	if opt.denied {
+		return ps.denied()
+	}
+	return ps.allowed()
+}
+
+func writePrefixes(w io.Writer, pool *netipuse.PoolIP) error {
+	var err error
+	pool.AllPrefixes(func(p netip.Prefix) bool {
+		_, err = fmt.Fprintln(w, p)
+		return err == nil
+	})
+	return err
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+
+	geo_filt "github.com/eterline/geo-filt"
+	"github.com/eterline/geo-filt/internal/adapter/ipmatch"
+	"github.com/eterline/geo-filt/internal/service/filter"
+)
+
+// lookup exit codes: every IP allowed, any IP denied, invalid input
+const (
+	lookupAllowed = 0
+	lookupDenied  = 1
+	lookupInvalid = 2
+)
+
+// prefixMatcher - provider able to return matched network of IP
+type prefixMatcher interface {
+	MatchPrefix(ip netip.Addr) (netip.Prefix, bool)
+}
+
+/*
+runLookup - prints filter decision of IPs from arguments or stdin.
+
+	Exit code is 0 if every IP is allowed, 1 if any IP is denied
+	and 2 on invalid IP or config.
+*/
+func runLookup(args []string) error {
+	fs := flag.NewFlagSet("lookup", flag.ExitOnError)
+	configFile := fs.String("config", "geo-filt.yaml", "plugin config file (YAML or JSON)")
+	verbose := fs.Bool("v", false, "print plugin logs to stderr")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: geo-filt lookup [flags] [ip ...]\n\n"+
+			"Prints filter decision, tested providers, matched network and location of each IP.\n"+
+			"IPs are read from stdin, one per line, if none given.\n"+
+			"Exit code: 0 all allowed, 1 any denied, 2 invalid IP or config.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	f, config, err := loadFilter(*configFile, *verbose)
+	if err != nil {
+		return &exitError{code: lookupInvalid, err: err}
+	}
+
+	if !config.Enabled {
+		fmt.Fprintln(os.Stderr, "geo-filt lookup: plugin is disabled in config, every request is passed")
+	}
+
+	code := lookupAllowed
+	report := func(s string) {
+		ip, err := netip.ParseAddr(s)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "geo-filt lookup: invalid ip address: %q\n", s)
+			code = lookupInvalid
+			return
+		}
+		ip = ip.Unmap()
+
+		d := printLookup(os.Stdout, f, ip)
+		if !d.Allowed() && config.Enabled && code == lookupAllowed {
+			code = lookupDenied
+		}
+	}
+
+	if fs.NArg() > 0 {
+		for _, s := range fs.Args() {
+			report(s)
+		}
+	} else {
+		sc := bufio.NewScanner(os.Stdin)
+		for sc.Scan() {
+			s := strings.TrimSpace(sc.Text())
+			if s == "" || strings.HasPrefix(s, "#") {
+				continue
+			}
+			report(s)
+		}
+		if err := sc.Err(); err != nil {
+			return &exitError{code: lookupInvalid, err: err}
+		}
+	}
+
+	if code != lookupAllowed {
+		return &exitError{code: code}
+	}
+	return nil
+}
+
+// printLookup - writes decision of IP with result of every tested provider
+func printLookup(w io.Writer, f *geo_filt.Filter, ip netip.Addr) filter.Decision {
+	d, traces := f.Explain(ip)
+
+	provider := d.Provider
+	if d.IsDefault() {
+		provider = "default action"
+	}
+	fmt.Fprintf(w, "%s\n  decision: %s (%s)\n", ip, d.Action, provider)
+
+	if g, ok := locate(f, ip); ok {
+		fmt.Fprintf(w, "  location: %s\n", formatGeoname(g))
+	} else {
+		fmt.Fprintf(w, "  location: unknown\n")
+	}
+
+	for _, t := range traces {
+		result := "no match"
+		if t.Matched {
+			result = "match"
+			if pm, ok := t.Provider.(prefixMatcher); ok {
+				if pf, ok := pm.MatchPrefix(ip); ok {
+					result += " " + pf.String()
+				}
+			}
+		}
+		fmt.Fprintf(w, "  %-8s %-6s %-16s %s\n", t.Tier, t.Action, t.Provider.Provider(), result)
+	}
+	fmt.Fprintln(w)
+
+	return d
+}
+
+// locate - returns location of IP from any configured geo matcher
+func locate(f *geo_filt.Filter, ip netip.Addr) (ipmatch.Geoname, bool) {
+	for _, l := range f.Locators {
+		if g, ok := l.Locate(ip); ok {
+			return g, true
+		}
+	}
+	return ipmatch.Geoname{}, false
+}
+
+func formatGeoname(g ipmatch.Geoname) string {
+	parts := make([]string, 0, 4)
+	if g.CountryCode != "" {
+		parts = append(parts, "country="+g.CountryCode)
+	}
+	if g.ContinentCode != "" {
+		parts = append(parts, "continent="+g.ContinentCode)
+	}
+	parts = append(parts, fmt.Sprintf("eu=%t", g.IsEU))
+	if g.ID != 0 {
+		parts = append(parts, fmt.Sprintf("geoname_id=%d", g.ID))
+	}
+	return strings.Join(parts, " ")
+}
@@ -4,4 +4,85 @@
 
 package main
 
-func main() {}
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+// exitError - error with process exit code
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("exit code %d", e.code)
+	}
+	return e.err.Error()
+}
+
+func commands() []command {
+	return []command{
+		{"serve", "run forward-auth / auth_request server", runServe},
+		{"lookup", "explain filter decision of IPs", runLookup},
+		{"compile", "compile geo database into snapshot file", runCompile},
+		{"export", "export filter networks as firewall or proxy rules", runExport},
+		{"diff", "compare countries networks of two database versions", runDiff},
+		{"validate", "report problems of plugin config", runValidate},
+		{"token", "issue bypass token", runToken},
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: geo-filt <command> [flags]\n\ncommands:\n")
+	for _, c := range commands() {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nrun 'geo-filt <command> -h' for command flags\n")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	if name == "-h" || name == "--help" || name == "help" {
+		usage()
+		return
+	}
+
+	for _, c := range commands() {
+		if c.name != name {
+			continue
+		}
+
+		err := c.run(os.Args[2:])
+		if err == nil {
+			return
+		}
+
+		var ee *exitError
+		if errors.As(err, &ee) {
+			if ee.err != nil {
+				fmt.Fprintf(os.Stderr, "geo-filt %s: %v\n", name, ee.err)
+			}
+			os.Exit(ee.code)
+		}
+		fmt.Fprintf(os.Stderr, "geo-filt %s: %v\n", name, err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "geo-filt: unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	geo_filt "github.com/eterline/geo-filt"
+)
+
+// headerOriginalIP - client IP header set by nginx auth_request location
+const headerOriginalIP = "X-Original-IP"
+
+/*
+authHandler - forward-auth / auth_request endpoint.
+
+	Client IP of auth subrequest is read from X-Original-IP,
+	X-Forwarded-For, Forwarded or X-Real-IP headers.
+	Allowed requests get 200 with X-Geo-* headers,
+	denied requests get plugin rejection response.
+*/
+type authHandler struct {
+	plugin       http.Handler
+	bypassHeader string // client header passed to plugin, canonical
+}
+
+func newAuthHandler(ctx context.Context, config *geo_filt.Config) (*authHandler, error) {
+	// auth subrequest always carries client IP in headers,
+	// geo headers are copied from passed request to response
+	config.HeaderBearer = true
+	config.GeoHeaders = true
+	if len(config.TrustedProxies) == 0 {
+		return nil, errors.New("trustedProxies is not set: client IP headers of auth requests are honored only from the proxy addresses")
+	}
+	if config.BypassHeader == "" {
+		config.BypassHeader = geo_filt.CreateConfig().BypassHeader
+	}
+	bypassHeader := http.CanonicalHeaderKey(config.BypassHeader)
+
+	allow := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		for key, values := range req.Header {
+			if strings.HasPrefix(key, "X-Geo-") && key != bypassHeader {
+				rw.Header()[key] = values
+			}
+		}
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	plugin, err := geo_filt.New(ctx, allow, config, "forward-auth")
+	if err != nil {
+		return nil, err
+	}
+
+	return &authHandler{
+		plugin:       plugin,
+		bypassHeader: bypassHeader,
+	}, nil
+}
+
+func (h *authHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	// X-Geo-* headers of response are set by plugin only
+	for key := range req.Header {
+		if strings.HasPrefix(key, "X-Geo-") && key != h.bypassHeader {
+			delete(req.Header, key)
+		}
+	}
+
+	// address set by proxy replaces chains passed from client
+	if ip := strings.TrimSpace(req.Header.Get(headerOriginalIP)); ip != "" {
+		req.Header.Del("X-Forwarded-For")
+		req.Header.Del("Forwarded")
+		req.Header.Set("X-Real-IP", ip)
+	}
+	h.plugin.ServeHTTP(rw, req)
+}
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	configFile := fs.String("config", "geo-filt.yaml", "plugin config file (YAML or JSON)")
+	listen := fs.String("listen", ":8080", "listen address")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: geo-filt serve [flags]\n\n"+
+			"Serves geo-filt decisions as Traefik forwardAuth / nginx auth_request endpoint.\n"+
+			"Allowed: 200 with X-Geo-* headers. Denied: configured rejection response (403).\n"+
+			"GET /healthz reports server liveness.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	config, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	auth, err := newAuthHandler(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte("ok\n"))
+	})
+	mux.Handle("/", auth)
+
+	srv := &http.Server{
+		Addr:              *listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	case <-ctx.Done():
+	}
+
+	shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return srv.Shutdown(shutdown)
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/eterline/geo-filt/internal/service/bypass"
+)
+
+// envBypassSecret - environment variable of bypass secret, keeps it out of shell history
+const envBypassSecret = "GEO_FILT_BYPASS_SECRET"
+
+/*
+runToken - issues bypass token signed with plugin bypass secret.
+
+	Secret is taken from -secret flag, GEO_FILT_BYPASS_SECRET
+	environment variable or 'bypassSecret' of config file.
+*/
+func runToken(args []string) error {
+	fs := flag.NewFlagSet("token", flag.ExitOnError)
+	configFile := fs.String("config", "", "plugin config file to take bypassSecret from (YAML or JSON)")
+	secret := fs.String("secret", "", "bypass secret, overrides "+envBypassSecret+" and config")
+	subject := fs.String("subject", "", "token subject written to plugin logs, e.g. user name")
+	ttl := fs.Duration("ttl", 24*time.Hour, "token lifetime")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: geo-filt token [flags]\n\n"+
+			"Issues bypass token passing requests denied by filter until it expires.\n"+
+			"Send it in plugin 'bypassHeader' (default X-Geo-Bypass) or 'bypassCookie'.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	key := *secret
+	if key == "" {
+		key = os.Getenv(envBypassSecret)
+	}
+	if key == "" && *configFile != "" {
+		config, err := loadConfig(*configFile)
+		if err != nil {
+			return &exitError{code: 2, err: err}
+		}
+		key = config.BypassSecret
+	}
+	if key == "" {
+		return &exitError{code: 2, err: errors.New("bypass secret is not set: use -secret, " + envBypassSecret + " or -config")}
+	}
+	if *subject == "" {
+		return &exitError{code: 2, err: errors.New("-subject is not set")}
+	}
+	if *ttl <= 0 {
+		return &exitError{code: 2, err: fmt.Errorf("invalid -ttl: %s", *ttl)}
+	}
+
+	v, err := bypass.NewVerifier(key, nil)
+	if err != nil {
+		return &exitError{code: 2, err: err}
+	}
+
+	expiry := time.Now().Add(*ttl)
+	token, err := v.Issue(*subject, expiry)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(token)
+	fmt.Fprintf(os.Stderr, "geo-filt token: subject %q, expires %s\n", *subject, expiry.UTC().Format(time.RFC3339))
+	return nil
+}
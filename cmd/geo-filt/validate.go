@@ -0,0 +1,72 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	geo_filt "github.com/eterline/geo-filt"
+)
+
+// validate exit codes: config has problems, filter can not be built
+const (
+	validateProblems = 1
+	validateInvalid  = 2
+)
+
+/*
+runValidate - reports problems of plugin config and its datasets.
+
+	Exit code is 0 if config has no problems, 1 if it has any
+	and 2 if filter can not be built from config.
+*/
+func runValidate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	configFile := fs.String("config", "geo-filt.yaml", "plugin config file (YAML or JSON)")
+	verbose := fs.Bool("v", false, "print plugin logs to stderr")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: geo-filt validate [flags]\n\n"+
+			"Builds filter of plugin config and reports invalid defined entries, unknown tags,\n"+
+			"tags resolved to zero networks, non-canonical prefixes and partially configured blocks.\n"+
+			"Exit code: 0 valid, 1 problems found, 2 config can not be loaded.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	config, err := loadConfig(*configFile)
+	if err != nil {
+		return &exitError{code: validateInvalid, err: err}
+	}
+
+	// every problem is collected, strict mode would stop on first check
+	strict := config.Strict
+	config.Strict = false
+
+	f, err := newFilter(config, *verbose)
+	if err != nil {
+		printProblems(os.Stdout, config.Validate())
+		return &exitError{code: validateInvalid, err: err}
+	}
+
+	if len(f.Problems) == 0 {
+		fmt.Printf("%s: config is valid\n", *configFile)
+		return nil
+	}
+
+	printProblems(os.Stdout, f.Problems)
+	if strict {
+		fmt.Printf("\nstrict mode is enabled: plugin fails to start with this config\n")
+	}
+	return &exitError{code: validateProblems}
+}
+
+func printProblems(w io.Writer, ps geo_filt.Problems) {
+	for _, p := range ps {
+		fmt.Fprintln(w, p.String())
+	}
+}
@@ -6,53 +6,171 @@ package geo_filt
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/netip"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/eterline/geo-filt/internal/adapter/ipmatch"
+	"github.com/eterline/geo-filt/internal/adapter/logger"
+	"github.com/eterline/geo-filt/internal/service/bypass"
 	"github.com/eterline/geo-filt/internal/service/filter"
 	"github.com/eterline/geo-filt/internal/service/ipscraper"
+	"github.com/eterline/geo-filt/pkg/netipuse"
 )
 
 type AllowService interface {
 	IsAllowed(ip netip.Addr) bool
+	Decide(ip netip.Addr) filter.Decision
 }
 
 type ExtractorIP interface {
 	ExtractIP(r *http.Request) (netip.Addr, bool)
+	ExtractIPSource(r *http.Request) (netip.Addr, string, bool)
 }
 
 // ===========================
 
 // Config - plugin basic configuration
 type Config struct {
-	Enabled      bool     `json:"enabled,omitempty" yaml:"enabled,omitempty"`
-	AllowPrivate bool     `json:"allowPrivate,omitempty" yaml:"allowPrivate,omitempty"`
-	HeaderBearer bool     `json:"headerBearer,omitempty" yaml:"headerBearer,omitempty"`
-	CodeFile     string   `json:"codeFile,omitempty" yaml:"codeFile,omitempty"`
-	GeoFile      []string `json:"geoFile,omitempty" yaml:"geoFile,omitempty"`
-	Tags         []string `json:"tags,omitempty" yaml:"tags,omitempty"`
-	Defined      []string `json:"defined,omitempty" yaml:"defined,omitempty"`
+	Enabled        bool     `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	AllowPrivate   bool     `json:"allowPrivate,omitempty" yaml:"allowPrivate,omitempty"`
+	HeaderBearer   bool     `json:"headerBearer,omitempty" yaml:"headerBearer,omitempty"`
+	TrustedProxies []string `json:"trustedProxies,omitempty" yaml:"trustedProxies,omitempty"`
+	CodeFile       string   `json:"codeFile,omitempty" yaml:"codeFile,omitempty"`
+	GeoFile        []string `json:"geoFile,omitempty" yaml:"geoFile,omitempty"`
+	MMDBFile       string   `json:"mmdbFile,omitempty" yaml:"mmdbFile,omitempty"`
+	DatFile        string   `json:"datFile,omitempty" yaml:"datFile,omitempty"`
+	SnapshotFile   string   `json:"snapshotFile,omitempty" yaml:"snapshotFile,omitempty"`
+	ReloadInterval string   `json:"reloadInterval,omitempty" yaml:"reloadInterval,omitempty"`
+	Tags           []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Defined        []string `json:"defined,omitempty" yaml:"defined,omitempty"`
+	DenyTags       []string `json:"denyTags,omitempty" yaml:"denyTags,omitempty"`
+	DenyDefined    []string `json:"denyDefined,omitempty" yaml:"denyDefined,omitempty"`
+	AsnFile        []string `json:"asnFile,omitempty" yaml:"asnFile,omitempty"`
+	Asn            []string `json:"asn,omitempty" yaml:"asn,omitempty"`
+	DenyAsn        []string `json:"denyAsn,omitempty" yaml:"denyAsn,omitempty"`
+	DefaultAction  string   `json:"defaultAction,omitempty" yaml:"defaultAction,omitempty"`
+	GeoHeaders     bool     `json:"geoHeaders,omitempty" yaml:"geoHeaders,omitempty"`
+	Mode           string   `json:"mode,omitempty" yaml:"mode,omitempty"`
+	ReportHeader   bool     `json:"reportHeader,omitempty" yaml:"reportHeader,omitempty"`
+	LogLevel       string   `json:"logLevel,omitempty" yaml:"logLevel,omitempty"`
+	LogFormat      string   `json:"logFormat,omitempty" yaml:"logFormat,omitempty"`
+	LogAllowed     bool     `json:"logAllowed,omitempty" yaml:"logAllowed,omitempty"`
+	LogSample      int      `json:"logSample,omitempty" yaml:"logSample,omitempty"`
+	MetricsPath    string   `json:"metricsPath,omitempty" yaml:"metricsPath,omitempty"`
+	Strict         bool     `json:"strict,omitempty" yaml:"strict,omitempty"`
+	BypassSecret   string   `json:"bypassSecret,omitempty" yaml:"bypassSecret,omitempty"`
+	BypassKeys     []string `json:"bypassKeys,omitempty" yaml:"bypassKeys,omitempty"`
+	BypassHeader   string   `json:"bypassHeader,omitempty" yaml:"bypassHeader,omitempty"`
+	BypassCookie   string   `json:"bypassCookie,omitempty" yaml:"bypassCookie,omitempty"`
+
+	StatusCode      int               `json:"statusCode,omitempty" yaml:"statusCode,omitempty"`
+	Body            string            `json:"body,omitempty" yaml:"body,omitempty"`
+	ContentType     string            `json:"contentType,omitempty" yaml:"contentType,omitempty"`
+	ResponseFormat  string            `json:"responseFormat,omitempty" yaml:"responseFormat,omitempty"`
+	ResponseHeaders map[string]string `json:"responseHeaders,omitempty" yaml:"responseHeaders,omitempty"`
+	RedirectURL     string            `json:"redirectURL,omitempty" yaml:"redirectURL,omitempty"`
+	RedirectCode    int               `json:"redirectCode,omitempty" yaml:"redirectCode,omitempty"`
 }
 
 func CreateConfig() *Config {
 	return &Config{
-		Enabled:      false,
-		AllowPrivate: false,
-		HeaderBearer: false,
-		CodeFile:     "",
-		GeoFile:      []string{},
-		Tags:         []string{},
-		Defined:      []string{},
+		Enabled:        false,
+		AllowPrivate:   false,
+		HeaderBearer:   false,
+		TrustedProxies: []string{},
+		CodeFile:       "",
+		GeoFile:        []string{},
+		MMDBFile:       "",
+		DatFile:        "",
+		SnapshotFile:   "",
+		ReloadInterval: "",
+		Tags:           []string{},
+		Defined:        []string{},
+		DenyTags:       []string{},
+		DenyDefined:    []string{},
+		AsnFile:        []string{},
+		Asn:            []string{},
+		DenyAsn:        []string{},
+		DefaultAction:  "deny",
+		GeoHeaders:     false,
+		Mode:           modeEnforce,
+		ReportHeader:   false,
+		LogLevel:       "info",
+		LogFormat:      "text",
+		LogAllowed:     false,
+		LogSample:      1,
+		MetricsPath:    "",
+		Strict:         false,
+		BypassSecret:   "",
+		BypassKeys:     []string{},
+		BypassHeader:   defaultBypassHeader,
+		BypassCookie:   "",
+
+		StatusCode:      http.StatusForbidden,
+		Body:            defaultRejectBody,
+		ContentType:     "",
+		ResponseFormat:  formatText,
+		ResponseHeaders: map[string]string{},
+		RedirectURL:     "",
+		RedirectCode:    0,
+	}
+}
+
+// geoSource - returns configured geo database files.
+func (c Config) geoSource() ipmatch.GeoSource {
+	return ipmatch.GeoSource{
+		CodeFile:     c.CodeFile,
+		GeoFile:      c.GeoFile,
+		MMDBFile:     c.MMDBFile,
+		DatFile:      c.DatFile,
+		SnapshotFile: c.SnapshotFile,
+	}
+}
+
+// geoSourceExists - tests available geo database files.
+func (c Config) geoSourceExists() bool {
+	return c.geoSource().Exists()
+}
+
+// reloadInterval - parses geo database reload interval, zero disables reloading.
+func (c Config) reloadInterval() (time.Duration, error) {
+	if c.ReloadInterval == "" {
+		return 0, nil
 	}
+	d, err := time.ParseDuration(c.ReloadInterval)
+	if err != nil {
+		return 0, fmt.Errorf("invalid reloadInterval: %w", err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid reloadInterval: negative duration %s", d)
+	}
+	return d, nil
 }
 
 // geoConfExists - tests available geo config strings.
 func (c Config) geoConfExists() bool {
-	return (len(c.Tags) > 0) &&
-		(len(c.GeoFile) > 0) &&
-		(c.CodeFile != "")
+	return (len(c.Tags) > 0) && c.geoSourceExists()
+}
+
+// geoDenyConfExists - tests available geo deny config strings.
+func (c Config) geoDenyConfExists() bool {
+	return (len(c.DenyTags) > 0) && c.geoSourceExists()
+}
+
+// asnConfExists - tests available ASN allow config strings.
+func (c Config) asnConfExists() bool {
+	return (len(c.Asn) > 0) && (len(c.AsnFile) > 0)
+}
+
+// asnDenyConfExists - tests available ASN deny config strings.
+func (c Config) asnDenyConfExists() bool {
+	return (len(c.DenyAsn) > 0) && (len(c.AsnFile) > 0)
 }
 
 // definedExists - tests available defined strings.
@@ -60,42 +178,225 @@ func (c Config) definedExists() bool {
 	return len(c.Defined) > 0
 }
 
+// denyDefinedExists - tests available deny defined strings.
+func (c Config) denyDefinedExists() bool {
+	return len(c.DenyDefined) > 0
+}
+
+// trustedExists - tests available trusted proxies strings.
+func (c Config) trustedExists() bool {
+	return len(c.TrustedProxies) > 0
+}
+
+// reportMode - parses plugin mode, reports whether decisions are only logged.
+func (c Config) reportMode() (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(c.Mode)) {
+	case "", modeEnforce:
+		return false, nil
+	case modeReport:
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid mode: %q, must be %s or %s", c.Mode, modeEnforce, modeReport)
+}
+
 // ===========================
 
+// plugin modes
+const (
+	modeEnforce = "enforce" // deny requests by decision
+	modeReport  = "report"  // log decision and always pass requests
+)
+
+const headerWouldBlock = "X-Geo-Would-Block"
+
 type GeoFiltPlugin struct {
 	name      string
 	enabled   bool
 	next      http.Handler
 	filter    AllowService
 	ipExtract ExtractorIP
+	reject    *rejectResponse
+
+	geoHeaders bool
+	locators   []Locator
+
+	report       bool
+	reportHeader bool
+
+	log        *slog.Logger
+	logAllowed bool
+	logSample  *logger.Sampler
+
+	metricsPath string
+	metrics     http.Handler
+
+	bypass       *bypass.Verifier // nil if bypass is not configured
+	bypassHeader string
+	bypassCookie string
 }
 
 func New(ctx context.Context, next http.Handler, config *Config, name string) (http.Handler, error) {
-	os.Stdout.WriteString("geo-filt - starting init configuration")
-	filter := filter.NewIpFilterService()
+	log, err := logger.New(os.Stdout, config.LogLevel, config.LogFormat)
+	if err != nil {
+		return nil, err
+	}
+	log = log.With("plugin", "geo-filt", "middleware", name)
+	log.Info("starting init configuration")
+
+	// headers are honored only from trusted proxies, without them RemoteAddr is used
+	var trusted *netipuse.PoolIP
+	if config.trustedExists() {
+		trusted, err = ipmatch.NewPoolDefined(config.TrustedProxies)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	reject, err := newRejectResponse(config)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := config.reportMode()
+	if err != nil {
+		return nil, err
+	}
+
 	plugin := &GeoFiltPlugin{
 		name:    name,
 		next:    next,
 		enabled: config.Enabled,
-		// set filter service to plugin
-		filter: filter,
 		// set extracting IP service to plugin
-		ipExtract: ipscraper.NewIpExtractor(config.HeaderBearer),
+		ipExtract: ipscraper.NewIpExtractor(config.HeaderBearer, trusted, log),
+		// set rejection response to plugin
+		reject: reject,
+		// inject geolocation headers to allowed requests
+		geoHeaders: config.GeoHeaders,
+		// log decisions without blocking
+		report:       report,
+		reportHeader: config.ReportHeader,
+		// decision logging
+		log:        log,
+		logAllowed: config.LogAllowed,
+		logSample:  logger.NewSampler(config.LogSample),
+		// decisions metrics endpoint
+		metricsPath: config.MetricsPath,
 	}
 
 	// if disabled, plugin will pass request in any case
 	if !config.Enabled {
-		os.Stdout.WriteString("geo-filt - disabled. Skip configuration")
+		log.Info("disabled, skip configuration")
 		return plugin, nil
 	}
 
+	// denied requests with valid bypass token or key are passed
+	if config.bypassExists() {
+		plugin.bypass, err = NewBypassVerifier(config)
+		if err != nil {
+			return nil, err
+		}
+		plugin.bypassHeader = config.BypassHeader
+		if plugin.bypassHeader == "" {
+			plugin.bypassHeader = defaultBypassHeader
+		}
+		plugin.bypassCookie = config.BypassCookie
+	}
+
+	// decisions metrics are exposed by plugin on configured path
+	var mtr *filter.Metrics
+	if config.MetricsPath != "" {
+		mtr = filter.NewMetrics()
+		plugin.metrics = mtr
+	}
+
+	// set filter service to plugin
+	f, err := NewFilter(ctx, config, log, mtr)
+	if err != nil {
+		return nil, err
+	}
+	plugin.filter = f
+	plugin.locators = f.Locators
+
+	// datasets of instances replaced on configuration reload are released
+	ipmatch.JoinGeneration(name, f.matchers)
+
+	log.Info("configured", "report", report)
+	return plugin, nil
+}
+
+// Filter - decision chain of plugin config
+type Filter struct {
+	*filter.IpFilterService
+	Locators []Locator
+	Problems Problems // config issues found while building chain
+
+	matchers []*ipmatch.PoolMatcherIP
+}
+
+/*
+Close - releases shared datasets of filter and stops their reloading.
+
+	Closed filter matches no dataset network.
+*/
+func (f *Filter) Close() error {
+	for _, mch := range f.matchers {
+		mch.Close()
+	}
+	return nil
+}
+
+/*
+NewFilter - builds decision chain of config the same way as plugin does.
+
+	Config problems are logged as warnings and returned in Filter.Problems,
+	in strict mode they are returned as error.
+*/
+func NewFilter(ctx context.Context, config *Config, log *slog.Logger, mtr *filter.Metrics) (*Filter, error) {
+	// options are checked before loading datasets
+	problems := config.Validate()
+	if config.Strict && len(problems) > 0 {
+		return nil, problems
+	}
+
+	action, err := filter.ParseAction(config.DefaultAction)
+	if err != nil {
+		return nil, err
+	}
+
+	reload, err := config.reloadInterval()
+	if err != nil {
+		return nil, err
+	}
+
+	ipFilter := filter.NewIpFilterService(action, log, mtr)
+	f := &Filter{IpFilterService: ipFilter}
+
+	// datasets of filter that is not built are released at once
+	built := false
+	defer func() {
+		if !built {
+			f.Close()
+		}
+	}()
+
 	// allow defined in config subnets and IPs (look at Config.Defined)
 	if config.definedExists() {
 		mch, err := ipmatch.NewMatcherDefinedSubnets(ctx, config.Defined)
 		if err != nil {
 			return nil, err
 		}
-		filter.Add(mch)
+		f.matchers = append(f.matchers, mch)
+		ipFilter.Allow(filter.TierDefined, mch)
+	}
+
+	// deny defined in config subnets and IPs (look at Config.DenyDefined)
+	if config.denyDefinedExists() {
+		mch, err := ipmatch.NewMatcherDefinedSubnets(ctx, config.DenyDefined)
+		if err != nil {
+			return nil, err
+		}
+		f.matchers = append(f.matchers, mch)
+		ipFilter.Deny(filter.TierDefined, mch.Named("defined-deny"))
 	}
 
 	// default allow for private network IPs
@@ -103,19 +404,128 @@ func New(ctx context.Context, next http.Handler, config *Config, name string) (h
 	// includes loopback IPs
 	if config.AllowPrivate {
 		mch := ipmatch.NewPrivateMatcher()
-		filter.Add(mch)
+		ipFilter.Allow(filter.TierDefined, mch)
+	}
+
+	// allow autonomous systems subnets
+	if config.asnConfExists() {
+		mch, err := newASNMatcher(ctx, config, config.Asn, reload, log)
+		if err != nil {
+			return nil, err
+		}
+		f.matchers = append(f.matchers, mch)
+		if mch.Pool().IsEmpty() {
+			problems.add("asn", "", "autonomous systems have no networks in asnFile")
+		}
+		ipFilter.Allow(filter.TierASN, mch)
+	}
+
+	// deny autonomous systems subnets
+	if config.asnDenyConfExists() {
+		mch, err := newASNMatcher(ctx, config, config.DenyAsn, reload, log)
+		if err != nil {
+			return nil, err
+		}
+		f.matchers = append(f.matchers, mch)
+		if mch.Pool().IsEmpty() {
+			problems.add("denyAsn", "", "autonomous systems have no networks in asnFile")
+		}
+		ipFilter.Deny(filter.TierASN, mch.Named("asn-deny"))
 	}
 
+	// both geo matchers are selected from the same index
+	var index *ipmatch.GeoIndex
+
 	// allow subnets from GeoDB
 	if config.geoConfExists() {
-		mch, err := ipmatch.NewMatcherGeoDB(ctx, config.CodeFile, config.GeoFile, config.Tags)
+		mch, err := newGeoMatcher(ctx, config, config.Tags, reload, log)
 		if err != nil {
 			return nil, err
 		}
-		filter.Add(mch)
+		f.matchers = append(f.matchers, mch)
+		ipFilter.Allow(filter.TierGeo, mch)
+		ipFilter.Countries(mch)
+		f.Locators = append(f.Locators, mch)
+		index = mch.Index()
 	}
 
-	return plugin, nil
+	// deny subnets from GeoDB
+	if config.geoDenyConfExists() {
+		mch, err := newGeoMatcher(ctx, config, config.DenyTags, reload, log)
+		if err != nil {
+			return nil, err
+		}
+		f.matchers = append(f.matchers, mch)
+		ipFilter.Deny(filter.TierGeo, mch.Named(mch.Provider()+"-deny"))
+		ipFilter.Countries(mch)
+		f.Locators = append(f.Locators, mch)
+		index = mch.Index()
+	}
+
+	// tags are resolved against index of every source network
+	if index != nil {
+		config.validateTags(&problems, index)
+	}
+
+	for _, p := range problems {
+		log.Warn("config problem", "option", p.Option, "value", p.Value, "problem", p.Message)
+	}
+	if config.Strict && len(problems) > 0 {
+		return nil, problems
+	}
+	f.Problems = problems
+	built = true
+
+	log.Info("filter configured", "default_action", action.String())
+	return f, nil
+}
+
+// newGeoMatcher - creates matcher of configured geo source
+// and starts its reloading if interval is set
+func newGeoMatcher(ctx context.Context, config *Config, codes []string, reload time.Duration, log *slog.Logger) (*ipmatch.PoolMatcherIP, error) {
+	mch, err := ipmatch.NewMatcherGeoSource(ctx, config.geoSource(), codes)
+	if err != nil {
+		return nil, err
+	}
+
+	if reload > 0 {
+		if err := mch.Watch(reload, log); err != nil {
+			mch.Close()
+			return nil, err
+		}
+	}
+
+	return mch, nil
+}
+
+// newASNMatcher - creates matcher of configured ASN files
+// and starts its reloading if interval is set
+func newASNMatcher(ctx context.Context, config *Config, asns []string, reload time.Duration, log *slog.Logger) (*ipmatch.PoolMatcherIP, error) {
+	mch, err := ipmatch.NewMatcherASN(ctx, config.AsnFile, asns)
+	if err != nil {
+		return nil, err
+	}
+
+	if reload > 0 {
+		if err := mch.Watch(reload, log); err != nil {
+			mch.Close()
+			return nil, err
+		}
+	}
+
+	return mch, nil
+}
+
+/*
+Close - releases shared datasets of plugin and stops their reloading.
+
+	Closed plugin matches no dataset network.
+*/
+func (plugin *GeoFiltPlugin) Close() error {
+	if c, ok := plugin.filter.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
 }
 
 func (plugin *GeoFiltPlugin) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
@@ -126,12 +536,97 @@ func (plugin *GeoFiltPlugin) ServeHTTP(rw http.ResponseWriter, req *http.Request
 		return
 	}
 
-	if ip, ok := plugin.ipExtract.ExtractIP(req); ok {
-		if plugin.filter.IsAllowed(ip) {
-			plugin.next.ServeHTTP(rw, req)
-			return
+	if plugin.report {
+		req.Header.Del(headerWouldBlock)
+	}
+
+	credential := ""
+	if plugin.bypass != nil {
+		credential = plugin.bypassCredential(req)
+	}
+
+	decision := filter.Decision{Action: filter.ActionDeny}
+	ip, source, ok := plugin.ipExtract.ExtractIPSource(req)
+	if ok {
+		decision = plugin.filter.Decide(ip)
+	}
+
+	if decision.Allowed() {
+		if plugin.logAllowed {
+			plugin.logDecision(req, ip, source, decision, "request allowed")
+		}
+		plugin.forward(rw, req, ip, decision)
+		return
+	}
+
+	// bypass credential passes request regardless of decision
+	if subject, ok := plugin.bypassSubject(req, credential); ok {
+		plugin.logBypass(req, ip, source, subject, decision)
+		plugin.forward(rw, req, ip, decision)
+		return
+	}
+
+	// report mode: log what would be done and pass request,
+	// metrics are not passed to clients that would be blocked
+	if plugin.report && !plugin.isMetrics(req) {
+		plugin.logDecision(req, ip, source, decision, "request would be blocked")
+		if plugin.reportHeader {
+			req.Header.Set(headerWouldBlock, "true")
 		}
+		plugin.forward(rw, req, ip, decision)
+		return
+	}
+
+	plugin.logDecision(req, ip, source, decision, "request denied")
+	plugin.reject.write(rw, req, ip, decision)
+}
+
+// forward - passes request to next handler, metrics endpoint request is served by plugin
+func (plugin *GeoFiltPlugin) forward(rw http.ResponseWriter, req *http.Request, ip netip.Addr, d filter.Decision) {
+	// metrics endpoint is served by plugin itself
+	if plugin.isMetrics(req) {
+		plugin.metrics.ServeHTTP(rw, req)
+		return
+	}
+
+	if plugin.geoHeaders {
+		plugin.setGeoHeaders(req.Header, ip, d)
+	}
+	plugin.next.ServeHTTP(rw, req)
+}
+
+// isMetrics - tests request of metrics endpoint
+func (plugin *GeoFiltPlugin) isMetrics(req *http.Request) bool {
+	return plugin.metrics != nil && req.URL.Path == plugin.metricsPath
+}
+
+// logDecision - writes sampled structured record of request decision
+func (plugin *GeoFiltPlugin) logDecision(req *http.Request, ip netip.Addr, source string, d filter.Decision, msg string) {
+	if !plugin.log.Enabled(req.Context(), slog.LevelInfo) || !plugin.logSample.Sample() {
+		return
+	}
+
+	country := d.Country
+	if country == "" && ip.IsValid() {
+		if g, ok := plugin.locate(ip); ok {
+			country = g.CountryCode
+		}
+	}
+
+	client := ""
+	if ip.IsValid() {
+		client = ip.String()
 	}
 
-	http.Error(rw, "403 Forbidden - Invalid request region", http.StatusForbidden)
+	plugin.log.LogAttrs(req.Context(), slog.LevelInfo, msg,
+		slog.String("action", d.Action.String()),
+		slog.String("client_ip", client),
+		slog.String("source", source),
+		slog.String("country", country),
+		slog.String("provider", d.Provider),
+		slog.Bool("default", d.IsDefault()),
+		slog.String("method", req.Method),
+		slog.String("host", req.Host),
+		slog.String("path", req.URL.Path),
+	)
 }
@@ -0,0 +1,75 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package geo_filt
+
+import (
+	"net/http"
+	"net/netip"
+	"strconv"
+
+	"github.com/eterline/geo-filt/internal/adapter/ipmatch"
+	"github.com/eterline/geo-filt/internal/service/filter"
+)
+
+// geolocation headers injected into allowed requests
+const (
+	headerGeoCountry   = "X-Geo-Country"
+	headerGeoContinent = "X-Geo-Continent"
+	headerGeoIsEU      = "X-Geo-Is-EU"
+	headerGeoClientIP  = "X-Geo-Client-IP"
+	headerGeoMatchedBy = "X-Geo-Matched-By"
+)
+
+var geoHeaders = []string{
+	headerGeoCountry,
+	headerGeoContinent,
+	headerGeoIsEU,
+	headerGeoClientIP,
+	headerGeoMatchedBy,
+}
+
+type Locator interface {
+	Locate(ip netip.Addr) (ipmatch.Geoname, bool)
+}
+
+// locate - returns location of IP from geo matchers
+func (plugin *GeoFiltPlugin) locate(ip netip.Addr) (ipmatch.Geoname, bool) {
+	for _, l := range plugin.locators {
+		if g, ok := l.Locate(ip); ok {
+			return g, true
+		}
+	}
+	return ipmatch.Geoname{}, false
+}
+
+/*
+setGeoHeaders - replaces client supplied geolocation headers with lookup result.
+
+	Client headers are removed even if IP is not extracted,
+	request passed by bypass or report mode gets no geo headers then.
+*/
+func (plugin *GeoFiltPlugin) setGeoHeaders(h http.Header, ip netip.Addr, d filter.Decision) {
+	for _, key := range geoHeaders {
+		h.Del(key)
+	}
+	if !ip.IsValid() {
+		return
+	}
+
+	h.Set(headerGeoClientIP, ip.String())
+	if d.Provider != "" {
+		h.Set(headerGeoMatchedBy, d.Provider)
+	}
+
+	if g, ok := plugin.locate(ip); ok {
+		if g.CountryCode != "" {
+			h.Set(headerGeoCountry, g.CountryCode)
+		}
+		if g.ContinentCode != "" {
+			h.Set(headerGeoContinent, g.ContinentCode)
+		}
+		h.Set(headerGeoIsEU, strconv.FormatBool(g.IsEU))
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package ipmatch
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/eterline/geo-filt/internal/adapter/mmdb"
+	"github.com/eterline/geo-filt/pkg/netipuse"
+)
+
+// ParseASN - parses autonomous system number as "13335" or "AS13335"
+func ParseASN(s string) (uint32, error) {
+	s = strings.TrimSpace(s)
+	if len(s) > 2 && strings.EqualFold(s[:2], "AS") {
+		s = s[2:]
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid autonomous system number: %q", s)
+	}
+	return uint32(n), nil
+}
+
+// asnSet - parses autonomous system numbers to set
+func asnSet(asns []string) (map[uint32]struct{}, error) {
+	set := make(map[uint32]struct{}, len(asns))
+	for _, s := range asns {
+		n, err := ParseASN(s)
+		if err != nil {
+			return nil, err
+		}
+		set[n] = struct{}{}
+	}
+	return set, nil
+}
+
+/*
+SelectASN - builds IP pool of autonomous systems networks.
+
+	Files are GeoLite2/iplocate ASN CSV files
+	(network,autonomous_system_number,autonomous_system_organization)
+	or ASN MMDB files selected by '.mmdb' extension.
+*/
+func SelectASN(asnFiles []string, asns []string) (*netipuse.PoolIP, error) {
+	selected, err := asnSet(asns)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := &netipuse.PoolIPBuilder{}
+	for _, file := range asnFiles {
+		file, err := resolvePath(file, true)
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.EqualFold(filepath.Ext(file), ".mmdb") {
+			err = selectASNMMDB(pool, file, selected)
+		} else {
+			err = selectASNCSV(pool, file, selected)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return pool.PoolIP()
+}
+
+func selectASNCSV(pool *netipuse.PoolIPBuilder, file string, selected map[uint32]struct{}) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	for {
+		record, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		if len(record) < 2 {
+			continue
+		}
+
+		n, err := ParseASN(record[1])
+		if err != nil {
+			continue
+		}
+
+		if _, ok := selected[n]; ok {
+			pf, err := netip.ParsePrefix(record[0])
+			if err != nil {
+				continue
+			}
+			pool.AddPrefix(pf)
+		}
+	}
+}
+
+func selectASNMMDB(pool *netipuse.PoolIPBuilder, file string, selected map[uint32]struct{}) error {
+	db, err := mmdb.Open(file)
+	if err != nil {
+		return err
+	}
+
+	cache := map[uint]bool{}
+	return db.Networks(func(network netip.Prefix, offset uint) error {
+		ok, seen := cache[offset]
+		if !seen {
+			record, err := db.Decode(offset)
+			if err != nil {
+				return err
+			}
+			_, ok = selected[uint32(mmdbUint(record, "autonomous_system_number"))]
+			cache[offset] = ok
+		}
+		if ok {
+			pool.AddPrefix(network)
+		}
+		return nil
+	})
+}
+
+func NewMatcherASN(ctx context.Context, asnFiles []string, asns []string) (*PoolMatcherIP, error) {
+	return NewSharedMatcher(ctx, Dataset{
+		Name:  "asn",
+		Files: asnFiles,
+		Tags:  asns,
+		Load: func() (*GeoPool, error) {
+			pool, err := SelectASN(asnFiles, asns)
+			if err != nil {
+				return nil, err
+			}
+			return &GeoPool{Pool: pool}, nil
+		},
+	})
+}
@@ -0,0 +1,311 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package ipmatch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+Dataset - source files and loader of matcher pool.
+
+	Matchers of datasets with the same name, files state and tags
+	share one immutable pool (look at NewSharedMatcher).
+	Pools of geo source are selected from its shared GeoIndex,
+	so source is loaded once for any count of tag sets.
+*/
+type Dataset struct {
+	Name   string
+	Files  []string
+	Tags   []string
+	Load   PoolLoader // loads pool of files, not used if Source is set
+	Source *GeoSource // geo source to select pool from by tags
+}
+
+// key - identity of dataset: name, files with size and mtime, normalized tags
+func (ds Dataset) key() (string, error) {
+	return ds.keyOf(true)
+}
+
+// identity - identity of dataset regardless of files state
+func (ds Dataset) identity() (string, error) {
+	return ds.keyOf(false)
+}
+
+func (ds Dataset) keyOf(state bool) (string, error) {
+	b := &strings.Builder{}
+	b.WriteString(ds.Name)
+
+	for _, file := range ds.Files {
+		file, err := resolvePath(file, state)
+		if err != nil {
+			return "", err
+		}
+		if !state {
+			fmt.Fprintf(b, "\x00%s", file)
+			continue
+		}
+		st, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(b, "\x00%s\x00%d\x00%d", file, st.Size(), st.ModTime().UnixNano())
+	}
+
+	tags := make([]string, 0, len(ds.Tags))
+	for _, tag := range ds.Tags {
+		tags = append(tags, strings.ToLower(strings.TrimSpace(tag)))
+	}
+	sort.Strings(tags)
+	b.WriteString("\x00\x00")
+	b.WriteString(strings.Join(tags, "\x00"))
+
+	return b.String(), nil
+}
+
+// datasetEntry - loaded value of dataset with count of holders
+type datasetEntry struct {
+	ready chan struct{}
+	value any
+	free  func() // releases values entry value depends on
+	err   error
+	refs  int
+}
+
+// datasetLoader - loads value of entry and returns release of values it depends on
+type datasetLoader func() (value any, free func(), err error)
+
+// datasetCache - registry of loaded pools and indexes
+type datasetCache struct {
+	mu      sync.Mutex
+	entries map[string]*datasetEntry
+}
+
+/*
+datasets - process-wide registry of loaded pools and indexes.
+
+	Traefik creates middleware instance for every router and
+	recreates them on dynamic configuration reload, so equal
+	datasets are loaded once and dropped with their last matcher.
+*/
+var datasets = &datasetCache{entries: map[string]*datasetEntry{}}
+
+/*
+acquire - returns value of key, loading it once for concurrent callers.
+
+	Returned release func must be called when value is not used anymore,
+	entry is removed from registry after its last release.
+*/
+func (c *datasetCache) acquire(key string, load datasetLoader) (any, func(), error) {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	if !ok {
+		e = &datasetEntry{ready: make(chan struct{})}
+		c.entries[key] = e
+	}
+	e.refs++
+	c.mu.Unlock()
+
+	if !ok {
+		e.value, e.free, e.err = load()
+		if e.err != nil {
+			// failed loads are not cached
+			c.mu.Lock()
+			if c.entries[key] == e {
+				delete(c.entries, key)
+			}
+			c.mu.Unlock()
+		}
+		close(e.ready)
+	}
+	<-e.ready
+
+	once := sync.Once{}
+	release := func() {
+		once.Do(func() {
+			c.mu.Lock()
+			e.refs--
+			last := e.refs == 0
+			if last && c.entries[key] == e {
+				delete(c.entries, key)
+			}
+			c.mu.Unlock()
+
+			if last && e.free != nil {
+				e.free()
+			}
+		})
+	}
+
+	if e.err != nil {
+		release()
+		return nil, nil, e.err
+	}
+	return e.value, release, nil
+}
+
+// acquirePool - returns shared pool of dataset with dataset key of its files state
+func (c *datasetCache) acquirePool(ds Dataset) (*GeoPool, string, func(), error) {
+	key, err := ds.key()
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	load := func() (any, func(), error) {
+		gp, err := ds.Load()
+		return gp, nil, err
+	}
+	if ds.Source != nil {
+		// pool keeps its index loaded for other tag sets
+		src := *ds.Source
+		load = func() (any, func(), error) {
+			gi, release, err := c.acquireIndex(src)
+			if err != nil {
+				return nil, nil, err
+			}
+			gp, err := gi.Select(ds.Tags)
+			if err != nil {
+				release()
+				return nil, nil, err
+			}
+			return gp, release, nil
+		}
+	}
+
+	v, release, err := c.acquire("pool\x00"+key, load)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return v.(*GeoPool), key, release, nil
+}
+
+// acquireIndex - returns shared index of geo source
+func (c *datasetCache) acquireIndex(src GeoSource) (*GeoIndex, func(), error) {
+	key, err := Dataset{Name: src.Name(), Files: src.Files()}.key()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	v, release, err := c.acquire("index\x00"+key, func() (any, func(), error) {
+		gi, err := NewGeoIndex(src)
+		return gi, nil, err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return v.(*GeoIndex), release, nil
+}
+
+/*
+acquireState - returns shared current pool of dataset.
+
+	State is keyed by dataset files and tags regardless of files state,
+	so matchers of every middleware instance share one state, its pool
+	is swapped by reload. Pool loaded before files changed is refreshed.
+*/
+func (c *datasetCache) acquireState(ds Dataset) (*poolState, func(), error) {
+	id, err := ds.identity()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	v, release, err := c.acquire("state\x00"+id, func() (any, func(), error) {
+		gp, key, free, err := c.acquirePool(ds)
+		if err != nil {
+			return nil, nil, err
+		}
+		st := &poolState{gp: gp, key: key, release: free}
+		return st, st.free, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// failed refresh keeps loaded pool, as reload does
+	st := v.(*poolState)
+	if key, err := ds.key(); err == nil && key != st.loadedKey() {
+		if gp, key, free, err := c.acquirePool(ds); err == nil {
+			st.swap(gp, key, free)
+		}
+	}
+
+	return st, release, nil
+}
+
+// poolState - current pool of dataset shared by matchers
+type poolState struct {
+	mu      sync.RWMutex
+	gp      *GeoPool
+	key     string // dataset key of pool files state
+	release func() // releases shared pool
+	watch   string // key of files watch, empty if files are not watched
+	freed   bool
+}
+
+func (s *poolState) current() *GeoPool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.gp
+}
+
+func (s *poolState) loadedKey() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.key
+}
+
+/*
+swap - replaces pool of state and releases previous shared pool.
+
+	Pool acquired after state is freed is released at once.
+*/
+func (s *poolState) swap(gp *GeoPool, key string, release func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.freed {
+		release()
+		return
+	}
+
+	if s.release != nil {
+		s.release()
+	}
+	s.gp, s.key, s.release = gp, key, release
+}
+
+// free - releases pool of state and stops watching its files, called after the last matcher is closed
+func (s *poolState) free() {
+	s.mu.Lock()
+	s.freed = true
+	release, watch := s.release, s.watch
+	s.release = nil
+	s.mu.Unlock()
+
+	if watch != "" {
+		watches.remove(watch, s)
+	}
+	if release != nil {
+		release()
+	}
+}
+
+/*
+NewSharedMatcher - creates matcher of dataset pool shared between matchers.
+
+	Pool is released when matcher is closed or its context is done.
+*/
+func NewSharedMatcher(ctx context.Context, ds Dataset) (*PoolMatcherIP, error) {
+	st, release, err := datasets.acquireState(ds)
+	if err != nil {
+		return nil, err
+	}
+	return newPoolMatcher(ctx, ds.Name, st, &ds, release), nil
+}
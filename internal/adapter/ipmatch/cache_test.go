@@ -0,0 +1,136 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package ipmatch
+
+import (
+	"context"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeASNFile(t *testing.T, file, rows string) {
+	t.Helper()
+
+	data := "network,autonomous_system_number,autonomous_system_organization\n" + rows
+	if err := os.WriteFile(file, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func registrySize() (entries, watched int) {
+	datasets.mu.Lock()
+	entries = len(datasets.entries)
+	datasets.mu.Unlock()
+
+	watches.mu.Lock()
+	watched = len(watches.watches)
+	watches.mu.Unlock()
+	return entries, watched
+}
+
+func TestSharedMatcherClose(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "asn.csv")
+	writeASNFile(t, file, "1.1.1.0/24,13335,Cloudflare\n8.8.8.0/24,15169,Google\n")
+
+	// matchers of two middleware instances, context is never done
+	var matchers []*PoolMatcherIP
+	for i := 0; i < 2; i++ {
+		for _, asn := range []string{"13335", "15169"} {
+			mch, err := NewMatcherASN(context.Background(), []string{file}, []string{asn})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := mch.Watch(time.Hour, nil); err != nil {
+				t.Fatal(err)
+			}
+			matchers = append(matchers, mch)
+		}
+	}
+
+	// two states with their pools, one watch of file
+	if entries, watched := registrySize(); entries != 4 || watched != 1 {
+		t.Fatalf("registry has %d entries and %d watches, want 4 and 1", entries, watched)
+	}
+	if matchers[0].state != matchers[2].state || matchers[0].state == matchers[1].state {
+		t.Error("matchers of equal datasets do not share state")
+	}
+
+	for _, mch := range matchers {
+		mch.Close()
+	}
+
+	if entries, watched := registrySize(); entries != 0 || watched != 0 {
+		t.Errorf("registry has %d entries and %d watches after close", entries, watched)
+	}
+	if matchers[0].Match(netip.MustParseAddr("1.1.1.1")) {
+		t.Error("closed matcher matches")
+	}
+}
+
+func TestSharedMatcherReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "asn.csv")
+	writeASNFile(t, file, "1.1.1.0/24,13335,Cloudflare\n")
+
+	allow, err := NewMatcherASN(context.Background(), []string{file}, []string{"13335"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer allow.Close()
+	deny, err := NewMatcherASN(context.Background(), []string{file}, []string{"15169"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer deny.Close()
+
+	for _, mch := range []*PoolMatcherIP{allow, deny} {
+		if err := mch.Watch(10*time.Millisecond, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeASNFile(t, file, "1.0.0.0/24,13335,Cloudflare\n8.8.8.0/24,15169,Google\n")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !deny.Match(netip.MustParseAddr("8.8.8.8")) || !allow.Match(netip.MustParseAddr("1.0.0.1")) {
+		if time.Now().After(deadline) {
+			t.Fatal("pools are not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if allow.Match(netip.MustParseAddr("1.1.1.1")) {
+		t.Error("reloaded pool keeps removed network")
+	}
+}
+
+func TestSharedMatcherRefresh(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "asn.csv")
+	writeASNFile(t, file, "1.1.1.0/24,13335,Cloudflare\n")
+
+	old, err := NewMatcherASN(context.Background(), []string{file}, []string{"13335"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer old.Close()
+
+	// file is changed without reload, matcher of new instance loads it
+	writeASNFile(t, file, "1.0.0.0/24,13335,Cloudflare\n")
+	now := time.Now().Add(time.Second)
+	if err := os.Chtimes(file, now, now); err != nil {
+		t.Fatal(err)
+	}
+
+	mch, err := NewMatcherASN(context.Background(), []string{file}, []string{"13335"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mch.Close()
+
+	if !mch.Match(netip.MustParseAddr("1.0.0.1")) || mch.Match(netip.MustParseAddr("1.1.1.1")) {
+		t.Error("matcher created after file change has old pool")
+	}
+}
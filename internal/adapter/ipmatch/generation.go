@@ -0,0 +1,90 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package ipmatch
+
+import (
+	"sync"
+	"time"
+)
+
+// generation - matchers of middleware instances sharing every dataset state
+type generation struct {
+	states   map[*poolState]bool
+	matchers []*PoolMatcherIP
+}
+
+// generationRegistry - current generation by middleware name
+type generationRegistry struct {
+	mu    sync.Mutex
+	names map[string]*generation
+}
+
+// generations - process-wide registry of middleware generations
+var generations = &generationRegistry{names: map[string]*generation{}}
+
+// generationGrace - time replaced generation keeps serving requests in flight
+var generationGrace = time.Minute
+
+/*
+JoinGeneration - holds matchers of middleware instance until name is rebuilt from other datasets.
+
+	Traefik recreates middleware instances on configuration reload
+	without closing replaced ones. Instances of one name sharing every
+	dataset state (routers of one middleware) form a generation.
+	Instance of other datasets replaces generation, matchers of replaced
+	generation are closed after grace period, so datasets of previous
+	configs are released. Defined matchers hold no shared dataset.
+*/
+func JoinGeneration(name string, matchers []*PoolMatcherIP) {
+	states := map[*poolState]bool{}
+	for _, m := range matchers {
+		if m.dataset != nil {
+			states[m.state] = true
+		}
+	}
+
+	generations.mu.Lock()
+	prev, ok := generations.names[name]
+	if ok && sameStates(prev.states, states) {
+		prev.matchers = append(prev.matchers, matchers...)
+		generations.mu.Unlock()
+		return
+	}
+	generations.names[name] = &generation{
+		states:   states,
+		matchers: append([]*PoolMatcherIP{}, matchers...),
+	}
+	generations.mu.Unlock()
+
+	if ok {
+		prev.closeAfter(generationGrace)
+	}
+}
+
+func sameStates(a, b map[*poolState]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for st := range a {
+		if !b[st] {
+			return false
+		}
+	}
+	return true
+}
+
+// closeAfter - closes matchers of replaced generation after grace period
+func (g *generation) closeAfter(grace time.Duration) {
+	closeAll := func() {
+		for _, m := range g.matchers {
+			m.Close()
+		}
+	}
+	if grace <= 0 {
+		closeAll()
+		return
+	}
+	time.AfterFunc(grace, closeAll)
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package ipmatch
+
+import (
+	"context"
+	"net/netip"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newTestInstance - builds watched matchers of middleware instance and joins its generation
+func newTestInstance(t *testing.T, name, file string, asns ...string) []*PoolMatcherIP {
+	t.Helper()
+
+	var matchers []*PoolMatcherIP
+	for _, asn := range asns {
+		mch, err := NewMatcherASN(context.Background(), []string{file}, []string{asn})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := mch.Watch(time.Hour, nil); err != nil {
+			t.Fatal(err)
+		}
+		matchers = append(matchers, mch)
+	}
+	// defined matchers do not split generation
+	defined, err := NewMatcherDefinedSubnets(context.Background(), []string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	matchers = append(matchers, defined)
+
+	JoinGeneration(name, matchers)
+	return matchers
+}
+
+func resetGenerations(t *testing.T, grace time.Duration) {
+	prev := generationGrace
+	generationGrace = grace
+	t.Cleanup(func() {
+		generationGrace = prev
+		generations.mu.Lock()
+		names := generations.names
+		generations.names = map[string]*generation{}
+		generations.mu.Unlock()
+		for _, g := range names {
+			g.closeAfter(0)
+		}
+	})
+}
+
+func TestGenerationBounded(t *testing.T) {
+	resetGenerations(t, 0)
+
+	file := filepath.Join(t.TempDir(), "asn.csv")
+	rows := ""
+	for asn := 1; asn <= 20; asn++ {
+		rows += "1.0." + strconv.Itoa(asn) + ".0/24," + strconv.Itoa(asn) + ",AS\n"
+	}
+	writeASNFile(t, file, rows)
+
+	// instances of other middleware name are kept
+	other := newTestInstance(t, "other", file, "20")
+
+	var prev []*PoolMatcherIP
+	for asn := 1; asn < 20; asn++ {
+		// routers of reloaded middleware with changed allow tags, deny tags are the same
+		var routers [][]*PoolMatcherIP
+		for i := 0; i < 3; i++ {
+			routers = append(routers, newTestInstance(t, "geofilter@file", file, strconv.Itoa(asn), "20"))
+		}
+
+		// states of current and other instances with their pools, one watch of file
+		if entries, watched := registrySize(); entries != 4 || watched != 1 {
+			t.Fatalf("reload %d: registry has %d entries and %d watches, want 4 and 1", asn, entries, watched)
+		}
+
+		ip := netip.MustParseAddr("1.0." + strconv.Itoa(asn) + ".1")
+		for _, r := range routers {
+			if !r[0].Match(ip) || !r[2].MustMatchParsed("10.0.0.1") {
+				t.Fatalf("reload %d: router of current generation does not match", asn)
+			}
+		}
+		if len(prev) > 0 && (prev[0].Match(netip.MustParseAddr("1.0."+strconv.Itoa(asn-1)+".1")) || prev[2].MustMatchParsed("10.0.0.1")) {
+			t.Fatalf("reload %d: replaced generation matches", asn)
+		}
+		prev = routers[0]
+	}
+
+	if !other[0].Match(netip.MustParseAddr("1.0.20.1")) {
+		t.Error("generation of other middleware is released")
+	}
+}
+
+func TestGenerationGrace(t *testing.T) {
+	resetGenerations(t, 50*time.Millisecond)
+
+	file := filepath.Join(t.TempDir(), "asn.csv")
+	writeASNFile(t, file, "1.1.1.0/24,13335,Cloudflare\n8.8.8.0/24,15169,Google\n")
+
+	old := newTestInstance(t, "geofilter@file", file, "13335")
+	newTestInstance(t, "geofilter@file", file, "15169")
+
+	// replaced instance serves requests in flight
+	if !old[0].Match(netip.MustParseAddr("1.1.1.1")) {
+		t.Fatal("replaced generation is released before grace period")
+	}
+	if entries, _ := registrySize(); entries != 4 {
+		t.Errorf("registry has %d entries in grace period, want 4", entries)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if entries, watched := registrySize(); entries == 2 && watched == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			entries, watched := registrySize()
+			t.Fatalf("registry has %d entries and %d watches after grace period, want 2 and 1", entries, watched)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if old[0].Match(netip.MustParseAddr("1.1.1.1")) {
+		t.Error("replaced generation matches after grace period")
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package ipmatch
+
+import (
+	"net/netip"
+	"sort"
+
+	"github.com/eterline/geo-filt/pkg/netipuse"
+)
+
+// Geoname - location record of geo database
+type Geoname struct {
+	ID            int64
+	ContinentCode string
+	CountryCode   string
+	IsEU          bool
+	List          bool // special list of geoip.dat as 'private' or 'google', matched but never located
+}
+
+// GeoSet - networks of one location
+type GeoSet struct {
+	Geoname Geoname
+	Pool    *netipuse.PoolIP
+}
+
+// GeoPool - IP pool with locations of its networks
+type GeoPool struct {
+	Pool  *netipuse.PoolIP
+	Sets  []GeoSet
+	Index *GeoIndex // index pool is selected from, nil if pool is loaded directly
+}
+
+// Locate - returns location of IP, ok is false if IP is not in pool or in special lists only
+func (gp *GeoPool) Locate(ip netip.Addr) (Geoname, bool) {
+	if !gp.Pool.Contains(ip) {
+		return Geoname{}, false
+	}
+	for _, set := range gp.Sets {
+		if !set.Geoname.List && set.Pool.Contains(ip) {
+			return set.Geoname, true
+		}
+	}
+	return Geoname{}, false
+}
+
+// geoPoolBuilder - builds GeoPool grouping networks by location
+type geoPoolBuilder struct {
+	all  netipuse.PoolIPBuilder
+	sets map[Geoname]*netipuse.PoolIPBuilder
+}
+
+func (b *geoPoolBuilder) set(g Geoname) *netipuse.PoolIPBuilder {
+	if b.sets == nil {
+		b.sets = map[Geoname]*netipuse.PoolIPBuilder{}
+	}
+	set, ok := b.sets[g]
+	if !ok {
+		set = &netipuse.PoolIPBuilder{}
+		b.sets[g] = set
+	}
+	return set
+}
+
+func (b *geoPoolBuilder) AddPrefix(g Geoname, pf netip.Prefix) {
+	b.all.AddPrefix(pf)
+	b.set(g).AddPrefix(pf)
+}
+
+func (b *geoPoolBuilder) AddSet(g Geoname, pool *netipuse.PoolIP) {
+	b.all.AddSet(pool)
+	b.set(g).AddSet(pool)
+}
+
+func (b *geoPoolBuilder) GeoPool() (*GeoPool, error) {
+	all, err := b.all.PoolIP()
+	if err != nil {
+		return nil, err
+	}
+
+	gp := &GeoPool{Pool: all, Sets: make([]GeoSet, 0, len(b.sets))}
+	for g, set := range b.sets {
+		pool, err := set.PoolIP()
+		if err != nil {
+			return nil, err
+		}
+		gp.Sets = append(gp.Sets, GeoSet{Geoname: g, Pool: pool})
+	}
+
+	sort.Slice(gp.Sets, func(i, j int) bool {
+		if gp.Sets[i].Geoname.CountryCode != gp.Sets[j].Geoname.CountryCode {
+			return gp.Sets[i].Geoname.CountryCode < gp.Sets[j].Geoname.CountryCode
+		}
+		return gp.Sets[i].Geoname.ID < gp.Sets[j].Geoname.ID
+	})
+
+	return gp, nil
+}
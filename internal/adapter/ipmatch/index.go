@@ -0,0 +1,249 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package ipmatch
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+
+	"github.com/eterline/geo-filt/pkg/netipuse"
+)
+
+/*
+GeoIndex - every network of geo source mapped to its location.
+
+	Source is loaded once into range map of location covers,
+	so index answers location of any IP and selects pools for any tag set.
+	Cover is the set of locations whose networks contain a segment of IPs,
+	lists of geoip.dat overlap (google, private and country lists), so
+	selected pool is the union of every selected location networks.
+	Overlapping networks are located to the most specific network of a country,
+	special lists (Geoname.List) are selected by tags but never located.
+	Networks are held once, per location pools are derived on select.
+	GeoIndex is immutable and safe for concurrent use.
+*/
+type GeoIndex struct {
+	geonames []Geoname
+	covers   []indexCover
+	ranges   *netipuse.RangeMap // cover id by segment
+}
+
+// indexCover - locations of index segment, location of the most specific network first
+type indexCover struct {
+	ids     []int
+	located int // location id of segment, -1 if segment is covered by lists only
+}
+
+// NewGeoIndex - loads every network of source into index
+func NewGeoIndex(src GeoSource) (*GeoIndex, error) {
+	gp, err := src.SelectAll()
+	if err != nil {
+		return nil, err
+	}
+	return newGeoIndex(gp)
+}
+
+func newGeoIndex(gp *GeoPool) (*GeoIndex, error) {
+	gi := &GeoIndex{geonames: make([]Geoname, len(gp.Sets))}
+	coverIDs := map[string]int{}
+
+	// values added are location ids, resolved values are cover ids
+	rmb := &netipuse.RangeMapBuilder{
+		Policy: netipuse.MostSpecificWins,
+		Resolve: func(ids []int) int {
+			key := fmt.Sprint(ids[0], sortedIDs(ids[1:]))
+			id, ok := coverIDs[key]
+			if !ok {
+				id = len(gi.covers)
+				coverIDs[key] = id
+				gi.covers = append(gi.covers, gi.newCover(ids))
+			}
+			return id
+		},
+	}
+	for id, set := range gp.Sets {
+		gi.geonames[id] = set.Geoname
+		for _, r := range set.Pool.Ranges() {
+			rmb.AddRange(r, id)
+		}
+	}
+
+	ranges, err := rmb.RangeMap()
+	if err != nil {
+		return nil, err
+	}
+	gi.ranges = ranges
+
+	return gi, nil
+}
+
+// newCover - returns cover of locations, located to the most specific not list location
+func (gi *GeoIndex) newCover(ids []int) indexCover {
+	c := indexCover{ids: append([]int{}, ids...), located: -1}
+	for _, id := range ids {
+		if !gi.geonames[id].List {
+			c.located = id
+			break
+		}
+	}
+	return c
+}
+
+// sortedIDs - returns sorted copy of location ids
+func sortedIDs(ids []int) []int {
+	ret := append([]int{}, ids...)
+	sort.Ints(ret)
+	return ret
+}
+
+// Locate - returns location of any IP of source, IPs of special lists only are not located
+func (gi *GeoIndex) Locate(ip netip.Addr) (Geoname, bool) {
+	c, _, ok := gi.ranges.Lookup(ip)
+	if !ok || gi.covers[c].located < 0 {
+		return Geoname{}, false
+	}
+	return gi.geonames[gi.covers[c].located], true
+}
+
+// LocateRange - returns location of IP with range of IPs containing it and located by the same networks
+func (gi *GeoIndex) LocateRange(ip netip.Addr) (Geoname, netipuse.PoolRange, bool) {
+	c, r, ok := gi.ranges.Lookup(ip)
+	if !ok || gi.covers[c].located < 0 {
+		return Geoname{}, netipuse.PoolRange{}, false
+	}
+	return gi.geonames[gi.covers[c].located], r, true
+}
+
+// Country - returns country ISO code of any IP of source
+func (gi *GeoIndex) Country(ip netip.Addr) (string, bool) {
+	g, ok := gi.Locate(ip)
+	return g.CountryCode, ok && g.CountryCode != ""
+}
+
+// Geonames - returns every location of source
+func (gi *GeoIndex) Geonames() []Geoname {
+	return append([]Geoname{}, gi.geonames...)
+}
+
+// Len - returns count of indexed ranges
+func (gi *GeoIndex) Len() int {
+	return gi.ranges.Len()
+}
+
+// Select - builds IP pool of locations selected by tags
+func (gi *GeoIndex) Select(codes []string) (*GeoPool, error) {
+	sel, err := ParseTags(codes)
+	if err != nil {
+		return nil, err
+	}
+	return gi.selectTags(sel)
+}
+
+// SelectAll - builds IP pool of every location
+func (gi *GeoIndex) SelectAll() (*GeoPool, error) {
+	return gi.selectTags(AllTags())
+}
+
+// SelectPool - builds IP pool of locations selected by tags without locations
+func (gi *GeoIndex) SelectPool(codes []string) (*netipuse.PoolIP, error) {
+	gp, err := gi.Select(codes)
+	if err != nil {
+		return nil, err
+	}
+	return gp.Pool, nil
+}
+
+/*
+ResolveTag - returns count of locations matched by tag and their networks.
+
+	Excluding tag (!DE) is resolved as the tag it excludes.
+*/
+func (gi *GeoIndex) ResolveTag(tag string) (locations int, pool *netipuse.PoolIP, err error) {
+	rule, _, err := parseTag(tag)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	selected := make([]bool, len(gi.geonames))
+	for id, g := range gi.geonames {
+		if rule.match(g) {
+			selected[id] = true
+			locations++
+		}
+	}
+
+	return locations, gi.ranges.PoolIP(gi.coverSelected(selected)), nil
+}
+
+// coverSelected - returns test of cover ids containing any selected location
+func (gi *GeoIndex) coverSelected(selected []bool) func(c int) bool {
+	covers := make([]bool, len(gi.covers))
+	for c, cover := range gi.covers {
+		for _, id := range cover.ids {
+			covers[c] = covers[c] || selected[id]
+		}
+	}
+	return func(c int) bool {
+		return covers[c]
+	}
+}
+
+func (gi *GeoIndex) selectTags(sel TagSelector) (*GeoPool, error) {
+	selected := make([]bool, len(gi.geonames))
+	for id, g := range gi.geonames {
+		selected[id] = sel.Match(g)
+	}
+
+	// networks of selected locations are collected in one pass,
+	// segments are sorted, so every location gets its ranges in order
+	builders := map[int]*netipuse.PoolIPBuilder{}
+	gi.ranges.All(func(r netipuse.PoolRange, c int) bool {
+		for _, id := range gi.covers[c].ids {
+			if !selected[id] {
+				continue
+			}
+			b, ok := builders[id]
+			if !ok {
+				b = &netipuse.PoolIPBuilder{}
+				builders[id] = b
+			}
+			b.AddRange(r)
+		}
+		return true
+	})
+
+	gp := &GeoPool{
+		Pool:  gi.ranges.PoolIP(gi.coverSelected(selected)),
+		Index: gi,
+	}
+	for id, g := range gi.geonames {
+		b, ok := builders[id]
+		if !ok {
+			continue
+		}
+		pool, err := b.PoolIP()
+		if err != nil {
+			return nil, err
+		}
+		gp.Sets = append(gp.Sets, GeoSet{Geoname: g, Pool: pool})
+	}
+
+	return gp, nil
+}
+
+/*
+All - calls yield for each indexed range with its location in ascending order, until yield returns false.
+
+	Ranges of special lists only are yielded with empty location.
+*/
+func (gi *GeoIndex) All(yield func(r netipuse.PoolRange, g Geoname) bool) {
+	gi.ranges.All(func(r netipuse.PoolRange, c int) bool {
+		if gi.covers[c].located < 0 {
+			return yield(r, Geoname{})
+		}
+		return yield(r, gi.geonames[gi.covers[c].located])
+	})
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package ipmatch
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/eterline/geo-filt/pkg/netipuse"
+)
+
+// overlappingIndex - index of geoip.dat like lists, special lists overlap country list
+func overlappingIndex(t *testing.T) *GeoIndex {
+	t.Helper()
+
+	b := &geoPoolBuilder{}
+	lists := map[string][]string{
+		"US":      {"8.8.0.0/16", "1.0.0.0/24"},
+		"GOOGLE":  {"8.8.8.0/24", "1.0.0.0/24"},
+		"DE":      {"2.0.0.0/16", "2001:db8::/32"},
+		"PRIVATE": {"10.0.0.0/8"},
+	}
+	for code, networks := range lists {
+		for _, s := range networks {
+			b.AddPrefix(Geoname{CountryCode: code, List: len(code) != 2}, netip.MustParsePrefix(s))
+		}
+	}
+
+	gp, err := b.GeoPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gi, err := newGeoIndex(gp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gi
+}
+
+func TestGeoIndexSelectOverlapping(t *testing.T) {
+	gi := overlappingIndex(t)
+
+	tests := []struct {
+		tags  []string
+		match []string
+		miss  []string
+	}{
+		{
+			tags:  []string{"US"},
+			match: []string{"8.8.8.8", "8.8.0.1", "8.8.255.255", "1.0.0.1"},
+			miss:  []string{"8.9.0.0", "2.0.0.1"},
+		},
+		{
+			tags:  []string{"google"},
+			match: []string{"8.8.8.8", "1.0.0.1", "1.0.0.255"},
+			miss:  []string{"8.8.0.1", "8.8.9.0"},
+		},
+		{
+			tags:  []string{"!google"},
+			match: []string{"8.8.8.8", "8.8.0.1", "1.0.0.1", "2.0.0.1", "2001:db8::1"},
+		},
+		{
+			tags:  []string{"DE"},
+			match: []string{"2.0.255.255", "2001:db8::1"},
+			miss:  []string{"8.8.8.8", "1.0.0.1"},
+		},
+	}
+
+	for _, tt := range tests {
+		gp, err := gi.Select(tt.tags)
+		if err != nil {
+			t.Fatalf("Select(%v): %v", tt.tags, err)
+		}
+		for _, s := range tt.match {
+			if !gp.Pool.Contains(netip.MustParseAddr(s)) {
+				t.Errorf("Select(%v) does not contain %s", tt.tags, s)
+			}
+		}
+		for _, s := range tt.miss {
+			if gp.Pool.Contains(netip.MustParseAddr(s)) {
+				t.Errorf("Select(%v) contains %s", tt.tags, s)
+			}
+		}
+	}
+}
+
+func TestGeoIndexSelectSets(t *testing.T) {
+	gi := overlappingIndex(t)
+
+	gp, err := gi.Select([]string{"US", "GOOGLE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"US":     "1.0.0.0/24,8.8.0.0/16",
+		"GOOGLE": "1.0.0.0/24,8.8.8.0/24",
+	}
+	if len(gp.Sets) != len(want) {
+		t.Fatalf("Select sets = %d, want %d", len(gp.Sets), len(want))
+	}
+	for _, set := range gp.Sets {
+		if got := joinPrefixes(set.Pool.Prefixes()); got != want[set.Geoname.CountryCode] {
+			t.Errorf("set %s = %s, want %s", set.Geoname.CountryCode, got, want[set.Geoname.CountryCode])
+		}
+	}
+}
+
+func TestGeoIndexLocate(t *testing.T) {
+	gi := overlappingIndex(t)
+
+	tests := []struct {
+		ip      string
+		country string
+	}{
+		{"8.8.8.8", "US"}, // more specific list is not located
+		{"8.8.7.255", "US"},
+		{"8.8.9.0", "US"},
+		{"1.0.0.1", "US"},
+		{"2001:db8::1", "DE"},
+		{"10.0.0.1", ""}, // list only
+		{"9.9.9.9", ""},
+	}
+
+	gp, err := gi.Select([]string{"US", "GOOGLE", "PRIVATE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		ip := netip.MustParseAddr(tt.ip)
+		g, ok := gi.Locate(ip)
+		if ok != (tt.country != "") || g.CountryCode != tt.country {
+			t.Errorf("Locate(%s) = %q, %v, want %q", tt.ip, g.CountryCode, ok, tt.country)
+		}
+		if c, ok := gi.Country(ip); ok != (tt.country != "") || c != tt.country {
+			t.Errorf("Country(%s) = %q, %v, want %q", tt.ip, c, ok, tt.country)
+		}
+		if _, _, ok := gi.LocateRange(ip); ok != (tt.country != "") {
+			t.Errorf("LocateRange(%s) ok = %v", tt.ip, ok)
+		}
+
+		// pool loaded without index locates the same way
+		if tt.country != "DE" {
+			if g, ok := gp.Locate(ip); ok != (tt.country != "") || g.CountryCode != tt.country {
+				t.Errorf("GeoPool.Locate(%s) = %q, %v, want %q", tt.ip, g.CountryCode, ok, tt.country)
+			}
+		}
+	}
+
+	gi.All(func(r netipuse.PoolRange, g Geoname) bool {
+		if g.List {
+			t.Errorf("All: range %s is located to list %s", r, g.CountryCode)
+		}
+		return true
+	})
+}
+
+func TestGeoIndexResolveTag(t *testing.T) {
+	gi := overlappingIndex(t)
+
+	locations, pool, err := gi.ResolveTag("google")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locations != 1 {
+		t.Errorf("ResolveTag locations = %d, want 1", locations)
+	}
+	if got := joinPrefixes(pool.Prefixes()); got != "1.0.0.0/24,8.8.8.0/24" {
+		t.Errorf("ResolveTag pool = %s", got)
+	}
+
+	locations, pool, err = gi.ResolveTag("FR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locations != 0 || !pool.IsEmpty() {
+		t.Errorf("ResolveTag(FR) = %d, %v, want no locations", locations, pool.Prefixes())
+	}
+}
+
+func joinPrefixes(pfs []netip.Prefix) string {
+	s := ""
+	for i, pf := range pfs {
+		if i > 0 {
+			s += ","
+		}
+		s += pf.String()
+	}
+	return s
+}
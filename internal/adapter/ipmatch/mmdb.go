@@ -0,0 +1,105 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package ipmatch
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/eterline/geo-filt/internal/adapter/mmdb"
+)
+
+// mmdbLocation - decoded location of MaxMind DB record
+type mmdbLocation struct {
+	geoname  Geoname
+	selected bool
+}
+
+// SelectMMDB - builds IP pool of MaxMind DB country database networks with country codes
+func SelectMMDB(mmdbFile string, codes []string) (*GeoPool, error) {
+	sel, err := ParseTags(codes)
+	if err != nil {
+		return nil, err
+	}
+	return selectMMDB(mmdbFile, sel)
+}
+
+func selectMMDB(mmdbFile string, sel TagSelector) (*GeoPool, error) {
+	file, err := resolvePath(mmdbFile, true)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := mmdb.Open(file)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := map[uint]mmdbLocation{}
+	pool := &geoPoolBuilder{}
+
+	err = db.Networks(func(network netip.Prefix, offset uint) error {
+		loc, seen := cache[offset]
+		if !seen {
+			record, err := db.Decode(offset)
+			if err != nil {
+				return err
+			}
+			loc.geoname = mmdbGeoname(record)
+			loc.selected = sel.Match(loc.geoname)
+			cache[offset] = loc
+		}
+		if loc.selected {
+			pool.AddPrefix(loc.geoname, network)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pool.GeoPool()
+}
+
+func NewMatcherMMDB(ctx context.Context, mmdbFile string, codes []string) (*PoolMatcherIP, error) {
+	return NewMatcherGeoSource(ctx, GeoSource{MMDBFile: mmdbFile}, codes)
+}
+
+// mmdbGeoname - extracts location of record,
+// registered country is used for records without country
+func mmdbGeoname(record any) Geoname {
+	g := Geoname{ContinentCode: mmdbString(record, "continent", "code")}
+	for _, key := range []string{"country", "registered_country"} {
+		if code := mmdbString(record, key, "iso_code"); code != "" {
+			g.CountryCode = code
+			g.ID = int64(mmdbUint(record, key, "geoname_id"))
+			g.IsEU, _ = mmdbValue(record, key, "is_in_european_union").(bool)
+			break
+		}
+	}
+	return g
+}
+
+// mmdbValue - extracts value of record by path
+func mmdbValue(record any, path ...string) any {
+	for _, key := range path {
+		m, ok := record.(map[string]any)
+		if !ok {
+			return nil
+		}
+		record = m[key]
+	}
+	return record
+}
+
+func mmdbString(record any, path ...string) string {
+	s, _ := mmdbValue(record, path...).(string)
+	return s
+}
+
+func mmdbUint(record any, path ...string) uint64 {
+	v, _ := mmdbValue(record, path...).(uint64)
+	return v
+}
@@ -8,6 +8,7 @@ import (
 	"context"
 	"encoding/csv"
 	"errors"
+	"fmt"
 	"io"
 	"net/netip"
 	"os"
@@ -17,9 +18,18 @@ import (
 	"github.com/eterline/geo-filt/pkg/netipuse"
 )
 
-type SubnetFileSelector map[int64]struct{}
+// SubnetFileSelector - selected locations of country code file by geoname id
+type SubnetFileSelector map[int64]Geoname
 
 func NewSubnetFileSelector(codesFile string, codes []string) (SubnetFileSelector, error) {
+	sel, err := ParseTags(codes)
+	if err != nil {
+		return nil, err
+	}
+	return newSubnetFileSelector(codesFile, sel)
+}
+
+func newSubnetFileSelector(codesFile string, sel TagSelector) (SubnetFileSelector, error) {
 	file, err := resolvePath(codesFile, true)
 	if err != nil {
 		return nil, err
@@ -31,11 +41,7 @@ func NewSubnetFileSelector(codesFile string, codes []string) (SubnetFileSelector
 	}
 	defer f.Close()
 
-	for i, code := range codes {
-		codes[i] = strings.TrimSpace(strings.ToUpper(code))
-	}
-
-	pool := map[int64]struct{}{}
+	pool := map[int64]Geoname{}
 	r := csv.NewReader(f)
 	for {
 		record, err := r.Read()
@@ -54,21 +60,41 @@ func NewSubnetFileSelector(codesFile string, codes []string) (SubnetFileSelector
 		if err != nil {
 			continue
 		}
-		for _, code := range codes {
-			if record[4] == code {
-				pool[id] = struct{}{}
-				continue
-			}
+
+		if g := geonameOf(id, record); sel.Match(g) {
+			pool[id] = g
 		}
 	}
 
 	return pool, nil
 }
 
+// geonameOf - creates location of country code file record
+func geonameOf(id int64, record []string) Geoname {
+	g := Geoname{
+		ID:            id,
+		ContinentCode: record[2],
+		CountryCode:   record[4],
+	}
+	if len(record) > 6 {
+		g.IsEU = record[6] == "1"
+	}
+	return g
+}
+
 func (sfs SubnetFileSelector) SelectSubnets(subnetsFile []string) (*netipuse.PoolIP, error) {
-	pool := &netipuse.PoolIPBuilder{}
+	gp, err := sfs.SelectGeo(subnetsFile)
+	if err != nil {
+		return nil, err
+	}
+	return gp.Pool, nil
+}
+
+// SelectGeo - selects subnets grouped by locations
+func (sfs SubnetFileSelector) SelectGeo(subnetsFile []string) (*GeoPool, error) {
+	pool := &geoPoolBuilder{}
 	if len(subnetsFile) < 1 {
-		return pool.PoolIP()
+		return pool.GeoPool()
 	}
 
 	for _, file := range subnetsFile {
@@ -102,17 +128,17 @@ func (sfs SubnetFileSelector) SelectSubnets(subnetsFile []string) (*netipuse.Poo
 				continue
 			}
 
-			if _, ok := sfs[id]; ok {
+			if g, ok := sfs[id]; ok {
 				pf, err := netip.ParsePrefix(record[0])
 				if err != nil {
 					continue
 				}
-				pool.AddPrefix(pf)
+				pool.AddPrefix(g, pf)
 			}
 		}
 	}
 
-	return pool.PoolIP()
+	return pool.GeoPool()
 }
 
 func (sfs SubnetFileSelector) Size() int {
@@ -120,26 +146,30 @@ func (sfs SubnetFileSelector) Size() int {
 }
 
 func NewMatcherGeoDB(ctx context.Context, countryFile string, subnetsFile []string, codes []string) (*PoolMatcherIP, error) {
-	sl, err := NewSubnetFileSelector(countryFile, codes)
-	if err != nil {
-		return nil, err
-	}
+	return NewMatcherGeoSource(ctx, GeoSource{CodeFile: countryFile, GeoFile: subnetsFile}, codes)
+}
 
-	pool, err := sl.SelectSubnets(subnetsFile)
-	if err != nil {
-		return nil, err
-	}
+/*
+ParseDefined - parses subnet or single IP string to prefix.
 
-	self := &PoolMatcherIP{
-		name: "geodb",
-		ctx:  ctx,
-		pool: pool,
+	Single IP is returned as full length prefix.
+	Prefix is returned as written, it may be not masked (10.0.0.1/8).
+*/
+func ParseDefined(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if p, err := netip.ParsePrefix(s); err == nil {
+		return p, nil
 	}
 
-	return self, nil
+	ip, err := netip.ParseAddr(s)
+	if err != nil || ip.Zone() != "" {
+		return netip.Prefix{}, fmt.Errorf("invalid IP or subnet: %q", s)
+	}
+	return netip.PrefixFrom(ip, ip.BitLen()), nil
 }
 
-func NewMatcherDefinedSubnets(ctx context.Context, subnets []string) (*PoolMatcherIP, error) {
+// NewPoolDefined - builds IP pool from subnets and single IPs strings
+func NewPoolDefined(subnets []string) (*netipuse.PoolIP, error) {
 	if subnets == nil {
 		return nil, errors.New("subnets is nil")
 	}
@@ -147,35 +177,22 @@ func NewMatcherDefinedSubnets(ctx context.Context, subnets []string) (*PoolMatch
 	pool := &netipuse.PoolIPBuilder{}
 
 	for _, s := range subnets {
-		if p, err := netip.ParsePrefix(s); err == nil {
-			pool.AddPrefix(p)
-			continue
-		}
-
-		if ip, err := netip.ParseAddr(s); err == nil {
-			var p netip.Prefix
-			if ip.Is4() {
-				p = netip.PrefixFrom(ip, 32)
-			} else {
-				p = netip.PrefixFrom(ip, 128)
-			}
+		// invalid entries are skipped, they are reported by config validation
+		if p, err := ParseDefined(s); err == nil {
 			pool.AddPrefix(p)
-			continue
 		}
 	}
 
-	set, err := pool.PoolIP()
+	return pool.PoolIP()
+}
+
+func NewMatcherDefinedSubnets(ctx context.Context, subnets []string) (*PoolMatcherIP, error) {
+	set, err := NewPoolDefined(subnets)
 	if err != nil {
 		return nil, err
 	}
 
-	self := &PoolMatcherIP{
-		name: "defined",
-		ctx:  ctx,
-		pool: set,
-	}
-
-	return self, nil
+	return newPoolMatcher(ctx, "defined", &poolState{gp: &GeoPool{Pool: set}}, nil, nil), nil
 }
 
 /*
@@ -197,3 +214,19 @@ func (m *PrivateMatcher) Match(ip netip.Addr) bool {
 func (m *PrivateMatcher) Provider() string {
 	return "private"
 }
+
+// privateNetworks - networks of netip.Addr IsPrivate and IsLoopback
+var privateNetworks = []string{
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"127.0.0.0/8",
+	"fc00::/7",
+	"::1/128",
+}
+
+// Pool - returns IP pool of networks matched by private matcher
+func (m *PrivateMatcher) Pool() *netipuse.PoolIP {
+	pool, _ := NewPoolDefined(privateNetworks)
+	return pool
+}
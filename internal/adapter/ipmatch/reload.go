@@ -0,0 +1,239 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package ipmatch
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/eterline/geo-filt/internal/adapter/logger"
+)
+
+// PoolLoader - builds IP pool for matcher
+type PoolLoader func() (*GeoPool, error)
+
+// fileStamp - state of file to detect changes
+type fileStamp struct {
+	size int64
+	mod  time.Time
+	sum  [sha256.Size]byte
+}
+
+// stampFile - reads file state, hash is computed only if size or mtime differs from prev
+func stampFile(file string, prev fileStamp) (fileStamp, error) {
+	file, err := resolvePath(file, true)
+	if err != nil {
+		return fileStamp{}, err
+	}
+
+	st, err := os.Stat(file)
+	if err != nil {
+		return fileStamp{}, err
+	}
+
+	stamp := fileStamp{size: st.Size(), mod: st.ModTime(), sum: prev.sum}
+	if stamp.size == prev.size && stamp.mod.Equal(prev.mod) {
+		return stamp, nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fileStamp{}, err
+	}
+	copy(stamp.sum[:], h.Sum(nil))
+
+	return stamp, nil
+}
+
+// stampFiles - reads files state, reports whether content of any file changed
+func stampFiles(files []string, prev []fileStamp) ([]fileStamp, bool, error) {
+	stamps := make([]fileStamp, len(files))
+	changed := len(prev) != len(files)
+
+	for i, file := range files {
+		var p fileStamp
+		if i < len(prev) {
+			p = prev[i]
+		}
+
+		st, err := stampFile(file, p)
+		if err != nil {
+			return nil, false, err
+		}
+		stamps[i] = st
+		changed = changed || st.sum != p.sum
+	}
+
+	return stamps, changed, nil
+}
+
+/*
+Watch - starts background polling of matcher dataset files.
+
+	If content of any file changes and stays the same for the next poll
+	(so partially written files are not read), pool is rebuilt by dataset
+	loader and swapped into matcher. Files are polled once for every
+	matcher of them: allow and deny matchers and matchers of other
+	middleware instances share one watch, which uses interval of the first
+	one. Old pool is kept if loading fails.
+	Polling stops when every matcher of files is closed.
+*/
+func (m *PoolMatcherIP) Watch(interval time.Duration, log *slog.Logger) error {
+	if m.dataset == nil {
+		return errors.New("matcher has no dataset to watch")
+	}
+	return watches.add(m.state, *m.dataset, interval, log)
+}
+
+// fileWatch - polling of dataset files with pool states reloaded on change
+type fileWatch struct {
+	states map[*poolState]Dataset
+	stop   chan struct{}
+}
+
+// watchRegistry - file watches by dataset name and files
+type watchRegistry struct {
+	mu      sync.Mutex
+	watches map[string]*fileWatch
+}
+
+// watches - process-wide registry of file watches
+var watches = &watchRegistry{watches: map[string]*fileWatch{}}
+
+// add - reloads state on changes of dataset files, starts polling of files if they are not watched
+func (r *watchRegistry) add(st *poolState, ds Dataset, interval time.Duration, log *slog.Logger) error {
+	key, err := Dataset{Name: ds.Name, Files: ds.Files}.identity()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w, ok := r.watches[key]
+	if !ok {
+		stamps, _, err := stampFiles(ds.Files, nil)
+		if err != nil {
+			return err
+		}
+		w = &fileWatch{states: map[*poolState]Dataset{}, stop: make(chan struct{})}
+		r.watches[key] = w
+		go r.poll(w, ds.Files, stamps, interval, logger.OrDiscard(log).With("dataset", ds.Name))
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if !st.freed {
+		st.watch = key
+		w.states[st] = ds
+	}
+
+	if len(w.states) == 0 {
+		close(w.stop)
+		delete(r.watches, key)
+	}
+	return nil
+}
+
+// remove - stops reloading of state, polling of files is stopped with their last state
+func (r *watchRegistry) remove(key string, st *poolState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w, ok := r.watches[key]
+	if !ok {
+		return
+	}
+	delete(w.states, st)
+	if len(w.states) == 0 {
+		close(w.stop)
+		delete(r.watches, key)
+	}
+}
+
+// reloaded - returns states of watch with their datasets
+func (r *watchRegistry) reloaded(w *fileWatch) map[*poolState]Dataset {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	states := make(map[*poolState]Dataset, len(w.states))
+	for st, ds := range w.states {
+		states[st] = ds
+	}
+	return states
+}
+
+func (r *watchRegistry) poll(w *fileWatch, files []string, stamps []fileStamp, interval time.Duration, log *slog.Logger) {
+	var pending []fileStamp
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+
+		next, changed, err := stampFiles(files, stamps)
+		if err != nil {
+			log.Warn("geo database reload skipped", "error", err)
+			continue
+		}
+		// nil is not assigned in tuple, Yaegi fails on it
+		if !changed {
+			stamps = next
+			pending = nil
+			continue
+		}
+
+		if !sameStamps(pending, next) {
+			pending = next
+			continue
+		}
+
+		failed := false
+		for st, ds := range r.reloaded(w) {
+			pool, key, release, err := datasets.acquirePool(ds)
+			if err != nil {
+				log.Error("geo database reload failed, old set is kept", "tags", ds.Tags, "error", err)
+				failed = true
+				continue
+			}
+			st.swap(pool, key, release)
+			log.Info("geo database reloaded", "tags", ds.Tags, "ranges", len(pool.Pool.Ranges()), "locations", len(pool.Sets))
+		}
+
+		// failed pools are loaded again on the next poll
+		if !failed {
+			stamps = next
+			pending = nil
+		}
+	}
+}
+
+func sameStamps(a, b []fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].size != b[i].size || !a[i].mod.Equal(b[i].mod) || a[i].sum != b[i].sum {
+			return false
+		}
+	}
+	return true
+}
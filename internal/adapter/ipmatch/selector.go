@@ -0,0 +1,142 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package ipmatch
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tag selector keys
+const (
+	tagCountry   = "country"
+	tagContinent = "continent"
+	tagEU        = "eu"
+)
+
+type tagRule struct {
+	key   string
+	value string
+}
+
+func (r tagRule) match(g Geoname) bool {
+	switch r.key {
+	case tagCountry:
+		return g.CountryCode == r.value
+	case tagContinent:
+		return g.ContinentCode == r.value
+	case tagEU:
+		return g.IsEU == (r.value == "TRUE")
+	}
+	return false
+}
+
+/*
+TagSelector - selects locations by tags.
+
+	Tag syntax:
+	  DE, country:DE  - country ISO code
+	  continent:EU    - continent code
+	  eu:true         - European Union membership (true or false)
+	  !<tag>          - excludes locations matched by tag
+
+	Location is selected if it matches any including tag
+	(or there are only excluding tags) and no excluding tag.
+*/
+type TagSelector struct {
+	include []tagRule
+	exclude []tagRule
+	all     bool
+}
+
+// AllTags - returns selector of every location
+func AllTags() TagSelector {
+	return TagSelector{all: true}
+}
+
+// ParseTags - parses tags to location selector
+func ParseTags(tags []string) (TagSelector, error) {
+	ts := TagSelector{}
+	for _, tag := range tags {
+		rule, negate, err := parseTag(tag)
+		if err != nil {
+			return TagSelector{}, err
+		}
+		if negate {
+			ts.exclude = append(ts.exclude, rule)
+		} else {
+			ts.include = append(ts.include, rule)
+		}
+	}
+	return ts, nil
+}
+
+func parseTag(tag string) (rule tagRule, negate bool, err error) {
+	s := strings.TrimSpace(tag)
+	if strings.HasPrefix(s, "!") {
+		negate = true
+		s = strings.TrimSpace(s[1:])
+	}
+
+	key, value, ok := strings.Cut(s, ":")
+	if !ok {
+		key, value = tagCountry, s
+	}
+	key = strings.ToLower(strings.TrimSpace(key))
+	value = strings.ToUpper(strings.TrimSpace(value))
+
+	if value == "" {
+		return tagRule{}, false, fmt.Errorf("invalid tag %q: empty value", tag)
+	}
+
+	switch key {
+	case tagCountry, tagContinent:
+	case tagEU:
+		switch value {
+		case "TRUE", "1", "YES":
+			value = "TRUE"
+		case "FALSE", "0", "NO":
+			value = "FALSE"
+		default:
+			return tagRule{}, false, fmt.Errorf("invalid tag %q: eu must be true or false", tag)
+		}
+	default:
+		return tagRule{}, false, fmt.Errorf("invalid tag %q: unknown selector %q", tag, key)
+	}
+
+	return tagRule{key: key, value: value}, negate, nil
+}
+
+// Empty - reports whether selector has no tags
+func (ts TagSelector) Empty() bool {
+	return !ts.all && len(ts.include) == 0 && len(ts.exclude) == 0
+}
+
+// Match - reports whether location is selected
+func (ts TagSelector) Match(g Geoname) bool {
+	if ts.all {
+		return true
+	}
+	if ts.Empty() {
+		return false
+	}
+
+	for _, r := range ts.exclude {
+		if r.match(g) {
+			return false
+		}
+	}
+
+	if len(ts.include) == 0 {
+		return true
+	}
+
+	for _, r := range ts.include {
+		if r.match(g) {
+			return true
+		}
+	}
+	return false
+}
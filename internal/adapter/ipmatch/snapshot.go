@@ -0,0 +1,386 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package ipmatch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/eterline/geo-filt/pkg/netipuse"
+)
+
+/*
+Snapshot file format, integers are big endian:
+
+	header, 48 bytes:
+	  magic     [6]byte  "GFSNAP"
+	  version   uint16
+	  length    uint64   payload length
+	  checksum  [32]byte SHA-256 of payload
+
+	payload:
+	  created   varint   unix time of compiling
+	  source    string   provider name of compiled source
+	  count     uvarint  locations count
+	  locations, sorted as GeoPool.Sets:
+	    id         varint
+	    continent  string
+	    country    string
+	    flags      byte     1 - EU member, 2 - geoip.dat list
+	    ranges4    uvarint  IPv4 ranges count
+	    ranges6    uvarint  IPv6 ranges count
+	  ranges of every location in the same order:
+	    IPv4 ranges  from, to [4]byte
+	    IPv6 ranges  from, to [16]byte
+
+	Strings are prefixed by uvarint length. Ranges are normalized
+	PoolRange arrays, the location table works as country index:
+	ranges of not selected locations are skipped without decoding.
+*/
+const (
+	SnapshotVersion = 1
+
+	snapshotMagic  = "GFSNAP"
+	snapshotHeader = len(snapshotMagic) + 2 + 8 + sha256.Size
+
+	snapshotFlagEU   = 1
+	snapshotFlagList = 2
+)
+
+// SnapshotInfo - summary of snapshot file
+type SnapshotInfo struct {
+	Version   int
+	Created   time.Time
+	Source    string
+	Locations int
+	Ranges4   int
+	Ranges6   int
+}
+
+// snapshotFlags - returns flags byte of location table entry
+func snapshotFlags(g Geoname) byte {
+	var flags byte
+	if g.IsEU {
+		flags |= snapshotFlagEU
+	}
+	if g.List {
+		flags |= snapshotFlagList
+	}
+	return flags
+}
+
+// snapshotLocation - location table entry of snapshot
+type snapshotLocation struct {
+	geoname Geoname
+	ranges4 int
+	ranges6 int
+}
+
+/*
+CompileSnapshot - selects every location of source and writes it to snapshot file.
+
+	File is replaced atomically, so running plugins reloading
+	the snapshot never read it partially written.
+*/
+func CompileSnapshot(file string, src GeoSource) (SnapshotInfo, error) {
+	gp, err := src.SelectAll()
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	dir := filepath.Dir(file)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(file)+".*")
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return SnapshotInfo{}, err
+	}
+
+	info, err := WriteSnapshot(tmp, gp, src.Name())
+	if err != nil {
+		tmp.Close()
+		return SnapshotInfo{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return SnapshotInfo{}, err
+	}
+	return info, nil
+}
+
+// WriteSnapshot - writes locations of IP pool to w in snapshot format
+func WriteSnapshot(w io.Writer, gp *GeoPool, source string) (SnapshotInfo, error) {
+	info := SnapshotInfo{
+		Version:   SnapshotVersion,
+		Created:   time.Unix(time.Now().Unix(), 0),
+		Source:    source,
+		Locations: len(gp.Sets),
+	}
+
+	locs := make([]snapshotLocation, 0, len(gp.Sets))
+	for _, set := range gp.Sets {
+		loc := snapshotLocation{geoname: set.Geoname}
+		for _, r := range set.Pool.Ranges() {
+			if r.From().Is4() {
+				loc.ranges4++
+			} else {
+				loc.ranges6++
+			}
+		}
+		info.Ranges4 += loc.ranges4
+		info.Ranges6 += loc.ranges6
+		locs = append(locs, loc)
+	}
+
+	payload := &bytes.Buffer{}
+	payload.Write(binary.AppendVarint(nil, info.Created.Unix()))
+	writeSnapshotString(payload, source)
+	payload.Write(binary.AppendUvarint(nil, uint64(len(locs))))
+
+	for _, loc := range locs {
+		payload.Write(binary.AppendVarint(nil, loc.geoname.ID))
+		writeSnapshotString(payload, loc.geoname.ContinentCode)
+		writeSnapshotString(payload, loc.geoname.CountryCode)
+		payload.WriteByte(snapshotFlags(loc.geoname))
+		payload.Write(binary.AppendUvarint(nil, uint64(loc.ranges4)))
+		payload.Write(binary.AppendUvarint(nil, uint64(loc.ranges6)))
+	}
+
+	for _, set := range gp.Sets {
+		for _, r := range set.Pool.Ranges() {
+			payload.Write(r.From().AsSlice())
+			payload.Write(r.To().AsSlice())
+		}
+	}
+
+	sum := sha256.Sum256(payload.Bytes())
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(snapshotMagic)
+	binary.Write(bw, binary.BigEndian, uint16(SnapshotVersion))
+	binary.Write(bw, binary.BigEndian, uint64(payload.Len()))
+	bw.Write(sum[:])
+	bw.Write(payload.Bytes())
+
+	if err := bw.Flush(); err != nil {
+		return SnapshotInfo{}, err
+	}
+	return info, nil
+}
+
+func writeSnapshotString(buf *bytes.Buffer, s string) {
+	buf.Write(binary.AppendUvarint(nil, uint64(len(s))))
+	buf.WriteString(s)
+}
+
+// SelectSnapshot - builds IP pool of snapshot file locations selected by tags
+func SelectSnapshot(snapshotFile string, codes []string) (*GeoPool, error) {
+	sel, err := ParseTags(codes)
+	if err != nil {
+		return nil, err
+	}
+	return selectSnapshot(snapshotFile, sel)
+}
+
+func selectSnapshot(snapshotFile string, sel TagSelector) (*GeoPool, error) {
+	file, err := resolvePath(snapshotFile, true)
+	if err != nil {
+		return nil, err
+	}
+
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	gp, _, err := DecodeSnapshot(buf, sel)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %s: %w", file, err)
+	}
+	return gp, nil
+}
+
+/*
+DecodeSnapshot - decodes snapshot locations selected by tags.
+
+	Checksum of payload is verified before decoding.
+	Ranges of selected locations are used as IP pools directly.
+*/
+func DecodeSnapshot(buf []byte, sel TagSelector) (*GeoPool, SnapshotInfo, error) {
+	if len(buf) < snapshotHeader || string(buf[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, SnapshotInfo{}, errors.New("not a geo-filt snapshot")
+	}
+
+	hdr := buf[len(snapshotMagic):snapshotHeader]
+	info := SnapshotInfo{Version: int(binary.BigEndian.Uint16(hdr))}
+	if info.Version != SnapshotVersion {
+		return nil, SnapshotInfo{}, fmt.Errorf("unsupported snapshot version %d", info.Version)
+	}
+
+	length := binary.BigEndian.Uint64(hdr[2:])
+	payload := buf[snapshotHeader:]
+	if uint64(len(payload)) != length {
+		return nil, SnapshotInfo{}, fmt.Errorf("snapshot payload is %d bytes, expected %d", len(payload), length)
+	}
+	if sum := sha256.Sum256(payload); !bytes.Equal(sum[:], hdr[10:]) {
+		return nil, SnapshotInfo{}, errors.New("snapshot checksum mismatch")
+	}
+
+	rd := &snapshotReader{buf: payload}
+	info.Created = time.Unix(rd.varint(), 0)
+	info.Source = rd.string()
+
+	count := rd.uvarint()
+	if count > uint64(len(payload)) {
+		return nil, SnapshotInfo{}, errors.New("snapshot location table is corrupted")
+	}
+
+	locs := make([]snapshotLocation, 0, count)
+	for i := uint64(0); i < count && rd.err == nil; i++ {
+		loc := snapshotLocation{}
+		loc.geoname.ID = rd.varint()
+		loc.geoname.ContinentCode = rd.string()
+		loc.geoname.CountryCode = rd.string()
+		flags := rd.byte()
+		loc.geoname.IsEU = flags&snapshotFlagEU != 0
+		loc.geoname.List = flags&snapshotFlagList != 0
+		loc.ranges4 = rd.count(2 * 4)
+		loc.ranges6 = rd.count(2 * 16)
+		info.Ranges4 += loc.ranges4
+		info.Ranges6 += loc.ranges6
+		locs = append(locs, loc)
+	}
+	if rd.err != nil {
+		return nil, SnapshotInfo{}, rd.err
+	}
+	info.Locations = len(locs)
+
+	if len(rd.buf) != info.Ranges4*2*4+info.Ranges6*2*16 {
+		return nil, SnapshotInfo{}, errors.New("snapshot ranges section is corrupted")
+	}
+
+	all := &netipuse.PoolIPBuilder{}
+	gp := &GeoPool{}
+	for _, loc := range locs {
+		size := loc.ranges4*2*4 + loc.ranges6*2*16
+		data := rd.bytes(size)
+		if !sel.Match(loc.geoname) {
+			continue
+		}
+
+		rr := make([]netipuse.PoolRange, 0, loc.ranges4+loc.ranges6)
+		for i := 0; i < loc.ranges4+loc.ranges6; i++ {
+			n := 4
+			if i >= loc.ranges4 {
+				n = 16
+			}
+			from, _ := netip.AddrFromSlice(data[:n])
+			to, _ := netip.AddrFromSlice(data[n : 2*n])
+			data = data[2*n:]
+			rr = append(rr, netipuse.PoolRangeFrom(from, to))
+		}
+
+		pool, err := netipuse.PoolIPFromRanges(rr)
+		if err != nil {
+			return nil, SnapshotInfo{}, fmt.Errorf("snapshot location %s: %w", loc.geoname.CountryCode, err)
+		}
+		all.AddSet(pool)
+		gp.Sets = append(gp.Sets, GeoSet{Geoname: loc.geoname, Pool: pool})
+	}
+
+	pool, err := all.PoolIP()
+	if err != nil {
+		return nil, SnapshotInfo{}, err
+	}
+	gp.Pool = pool
+
+	return gp, info, nil
+}
+
+// snapshotReader - sequential reader of snapshot payload, keeps first error
+type snapshotReader struct {
+	buf []byte
+	err error
+}
+
+func (rd *snapshotReader) fail() {
+	if rd.err == nil {
+		rd.err = errors.New("snapshot payload is truncated")
+	}
+	rd.buf = nil
+}
+
+func (rd *snapshotReader) uvarint() uint64 {
+	v, n := binary.Uvarint(rd.buf)
+	if n <= 0 {
+		rd.fail()
+		return 0
+	}
+	rd.buf = rd.buf[n:]
+	return v
+}
+
+func (rd *snapshotReader) varint() int64 {
+	v, n := binary.Varint(rd.buf)
+	if n <= 0 {
+		rd.fail()
+		return 0
+	}
+	rd.buf = rd.buf[n:]
+	return v
+}
+
+// count - reads count of items with size, limited by payload length
+func (rd *snapshotReader) count(size int) int {
+	v := rd.uvarint()
+	if v > uint64(len(rd.buf)/size) {
+		rd.fail()
+		return 0
+	}
+	return int(v)
+}
+
+func (rd *snapshotReader) bytes(n int) []byte {
+	if n > len(rd.buf) {
+		rd.fail()
+		return nil
+	}
+	b := rd.buf[:n]
+	rd.buf = rd.buf[n:]
+	return b
+}
+
+func (rd *snapshotReader) byte() byte {
+	b := rd.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (rd *snapshotReader) string() string {
+	return string(rd.bytes(rd.count(1)))
+}
+
+func NewMatcherSnapshot(ctx context.Context, snapshotFile string, codes []string) (*PoolMatcherIP, error) {
+	return NewMatcherGeoSource(ctx, GeoSource{SnapshotFile: snapshotFile}, codes)
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package ipmatch
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func testSnapshot(t *testing.T) (*GeoPool, []byte) {
+	t.Helper()
+
+	b := &geoPoolBuilder{}
+	locations := []struct {
+		geoname  Geoname
+		networks []string
+	}{
+		{Geoname{ID: 2921044, ContinentCode: "EU", CountryCode: "DE", IsEU: true}, []string{"2.160.0.0/12", "5.1.0.0/17", "2a02:8100::/27"}},
+		{Geoname{ID: 6252001, ContinentCode: "NA", CountryCode: "US"}, []string{"8.8.8.0/24", "3.0.0.0/9", "2001:4860::/32"}},
+		{Geoname{ID: 2017370, ContinentCode: "EU", CountryCode: "RU"}, []string{"5.3.0.0/16"}},
+		{Geoname{ID: 1, CountryCode: "PRIVATE", List: true}, []string{"fc00::/7"}},
+	}
+	for _, loc := range locations {
+		for _, s := range loc.networks {
+			b.AddPrefix(loc.geoname, netip.MustParsePrefix(s))
+		}
+	}
+
+	gp, err := b.GeoPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := WriteSnapshot(buf, gp, "csv"); err != nil {
+		t.Fatal(err)
+	}
+	return gp, buf.Bytes()
+}
+
+// snapshotFrom - wraps payload into snapshot header with valid checksum
+func snapshotFrom(payload []byte) []byte {
+	sum := sha256.Sum256(payload)
+	buf := []byte(snapshotMagic)
+	buf = binary.BigEndian.AppendUint16(buf, SnapshotVersion)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(len(payload)))
+	buf = append(buf, sum[:]...)
+	return append(buf, payload...)
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	gp, buf := testSnapshot(t)
+
+	got, info, err := DecodeSnapshot(buf, AllTags())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Version != SnapshotVersion || info.Source != "csv" || info.Locations != 4 ||
+		info.Ranges4 != 5 || info.Ranges6 != 3 || info.Created.IsZero() {
+		t.Errorf("DecodeSnapshot info = %+v", info)
+	}
+	if len(got.Sets) != len(gp.Sets) {
+		t.Fatalf("DecodeSnapshot has %d locations, want %d", len(got.Sets), len(gp.Sets))
+	}
+	for i, set := range gp.Sets {
+		if got.Sets[i].Geoname != set.Geoname || !reflect.DeepEqual(got.Sets[i].Pool.Ranges(), set.Pool.Ranges()) {
+			t.Errorf("location %d = %+v %v, want %+v %v", i,
+				got.Sets[i].Geoname, got.Sets[i].Pool.Ranges(), set.Geoname, set.Pool.Ranges())
+		}
+	}
+	if !reflect.DeepEqual(got.Pool.Ranges(), gp.Pool.Ranges()) {
+		t.Errorf("DecodeSnapshot pool = %v, want %v", got.Pool.Ranges(), gp.Pool.Ranges())
+	}
+}
+
+func TestSnapshotSelect(t *testing.T) {
+	_, buf := testSnapshot(t)
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "geo.snap")
+	if err := os.WriteFile(file, buf, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// snapshot compiled from snapshot keeps every location
+	compiled := filepath.Join(dir, "compiled.snap")
+	if _, err := CompileSnapshot(compiled, GeoSource{SnapshotFile: file}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []string{file, compiled} {
+		gp, err := SelectSnapshot(f, []string{"eu:true", "country:US"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, s := range []string{"2.160.0.1", "2a02:8100::1", "8.8.8.8", "3.127.255.255"} {
+			if !gp.Pool.Contains(netip.MustParseAddr(s)) {
+				t.Errorf("%s: selected pool does not contain %s", filepath.Base(f), s)
+			}
+		}
+		for _, s := range []string{"5.3.0.1", "fc00::1", "3.128.0.0"} {
+			if gp.Pool.Contains(netip.MustParseAddr(s)) {
+				t.Errorf("%s: selected pool contains %s", filepath.Base(f), s)
+			}
+		}
+		if g, ok := gp.Locate(netip.MustParseAddr("5.1.0.1")); !ok || g.CountryCode != "DE" || !g.IsEU {
+			t.Errorf("%s: Locate = %+v, %v, want DE", filepath.Base(f), g, ok)
+		}
+	}
+}
+
+func TestSnapshotCorrupted(t *testing.T) {
+	_, good := testSnapshot(t)
+
+	modify := func(at int, fn func(byte) byte) []byte {
+		buf := append([]byte{}, good...)
+		buf[at] = fn(buf[at])
+		return buf
+	}
+	flip := func(b byte) byte { return b ^ 0x01 }
+
+	// payloads with valid checksum
+	loc := func(ranges4 uint64) []byte {
+		p := binary.AppendVarint(nil, 1)
+		p = append(p, 2, 'E', 'U', 2, 'D', 'E', 1)
+		return binary.AppendUvarint(binary.AppendUvarint(p, ranges4), 0)
+	}
+	head := append(binary.AppendVarint(nil, 1700000000), 3, 'c', 's', 'v')
+	payload := func(parts ...[]byte) []byte {
+		return snapshotFrom(bytes.Join(append([][]byte{head}, parts...), nil))
+	}
+
+	tests := []struct {
+		name string
+		buf  []byte
+	}{
+		{"empty", nil},
+		{"magic", modify(0, flip)},
+		{"version", modify(len(snapshotMagic)+1, func(byte) byte { return 2 })},
+		{"truncated header", good[:snapshotHeader-1]},
+		{"truncated payload", good[:len(good)-1]},
+		{"trailing data", append(append([]byte{}, good...), 0)},
+		{"payload checksum", modify(len(good)-3, flip)},
+		{"header checksum", modify(snapshotHeader-1, flip)},
+		{"location count", payload([]byte{0x80, 0x80, 0x04})},
+		{"truncated location table", payload([]byte{1}, loc(1)[:4])},
+		{"ranges count", payload([]byte{1}, loc(100), make([]byte, 8))},
+		{"ranges section", payload([]byte{1}, loc(1), []byte{1, 0, 0, 0, 1, 0, 0, 255}, []byte{0})},
+		{"reversed range", payload([]byte{1}, loc(1), []byte{1, 0, 0, 255, 1, 0, 0, 0})},
+		{"unsorted ranges", payload([]byte{1}, loc(2), []byte{2, 0, 0, 0, 2, 0, 0, 255, 1, 0, 0, 0, 1, 0, 0, 255})},
+	}
+
+	for _, tt := range tests {
+		if gp, _, err := DecodeSnapshot(tt.buf, AllTags()); err == nil {
+			t.Errorf("%s: DecodeSnapshot succeeds with %d locations", tt.name, len(gp.Sets))
+		}
+	}
+
+	// valid hand-written payload is accepted
+	gp, _, err := DecodeSnapshot(payload([]byte{1}, loc(1), []byte{1, 0, 0, 0, 1, 0, 0, 255}), AllTags())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gp.Pool.Contains(netip.MustParseAddr("1.0.0.7")) || gp.Sets[0].Geoname.CountryCode != "DE" {
+		t.Errorf("DecodeSnapshot of valid payload = %+v", gp.Sets)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package ipmatch
+
+import (
+	"context"
+)
+
+/*
+GeoSource - geo database files set.
+
+	Sources are selected by priority:
+	compiled snapshot file, MMDB file, geoip.dat file, CSV files pair.
+*/
+type GeoSource struct {
+	CodeFile     string
+	GeoFile      []string
+	MMDBFile     string
+	DatFile      string
+	SnapshotFile string
+}
+
+// Exists - tests available geo database files
+func (src GeoSource) Exists() bool {
+	return src.SnapshotFile != "" || src.MMDBFile != "" || src.DatFile != "" ||
+		((len(src.GeoFile) > 0) && (src.CodeFile != ""))
+}
+
+// Name - returns provider name of source
+func (src GeoSource) Name() string {
+	switch {
+	case src.SnapshotFile != "":
+		return "snapshot"
+	case src.MMDBFile != "":
+		return "mmdb"
+	case src.DatFile != "":
+		return "geoip-dat"
+	}
+	return "geodb"
+}
+
+// Files - returns files of selected source
+func (src GeoSource) Files() []string {
+	switch {
+	case src.SnapshotFile != "":
+		return []string{src.SnapshotFile}
+	case src.MMDBFile != "":
+		return []string{src.MMDBFile}
+	case src.DatFile != "":
+		return []string{src.DatFile}
+	}
+	return append([]string{src.CodeFile}, src.GeoFile...)
+}
+
+// Select - builds IP pool of source networks with country codes
+func (src GeoSource) Select(codes []string) (*GeoPool, error) {
+	sel, err := ParseTags(codes)
+	if err != nil {
+		return nil, err
+	}
+	return src.selectTags(sel)
+}
+
+// SelectAll - builds IP pool of every source network with its location
+func (src GeoSource) SelectAll() (*GeoPool, error) {
+	return src.selectTags(AllTags())
+}
+
+func (src GeoSource) selectTags(sel TagSelector) (*GeoPool, error) {
+	switch {
+	case src.SnapshotFile != "":
+		return selectSnapshot(src.SnapshotFile, sel)
+	case src.MMDBFile != "":
+		return selectMMDB(src.MMDBFile, sel)
+	case src.DatFile != "":
+		return selectGeoIPDat(src.DatFile, sel)
+	}
+
+	sl, err := newSubnetFileSelector(src.CodeFile, sel)
+	if err != nil {
+		return nil, err
+	}
+	return sl.SelectGeo(src.GeoFile)
+}
+
+// NewMatcherGeoSource - creates matcher of source networks selected by codes from shared source index
+func NewMatcherGeoSource(ctx context.Context, src GeoSource, codes []string) (*PoolMatcherIP, error) {
+	return NewSharedMatcher(ctx, Dataset{
+		Name:   src.Name(),
+		Files:  src.Files(),
+		Tags:   codes,
+		Source: &src,
+	})
+}
@@ -17,20 +17,135 @@ import (
 )
 
 type PoolMatcherIP struct {
-	name string
-	ctx  context.Context
-	pool *netipuse.PoolIP
+	name   string
+	ctx    context.Context
+	cancel context.CancelFunc
+	state  *poolState // current pool, shared by matchers of equal datasets
+
+	dataset *Dataset // source of shared pool, nil for defined matchers
+	release func()   // releases shared pool state
+}
+
+/*
+newPoolMatcher - creates matcher of pool state.
+
+	Matcher is closed when its context is done, Traefik keeps
+	context of replaced middleware alive, so owners close matchers.
+*/
+func newPoolMatcher(ctx context.Context, name string, st *poolState, ds *Dataset, release func()) *PoolMatcherIP {
+	ctx, cancel := context.WithCancel(ctx)
+	self := &PoolMatcherIP{
+		name:    name,
+		ctx:     ctx,
+		cancel:  cancel,
+		state:   st,
+		dataset: ds,
+		release: release,
+	}
+	context.AfterFunc(ctx, self.drop)
+	return self
 }
 
 func (m *PoolMatcherIP) Provider() string {
 	return m.name
 }
 
+// Named - sets provider name of matcher
+func (m *PoolMatcherIP) Named(name string) *PoolMatcherIP {
+	m.name = name
+	return m
+}
+
 func (m *PoolMatcherIP) Match(ip netip.Addr) bool {
+	return m.current().Pool.Contains(ip)
+}
+
+// Pool - returns current IP pool of matcher
+func (m *PoolMatcherIP) Pool() *netipuse.PoolIP {
+	return m.current().Pool
+}
+
+// Index - returns index of every source network, nil if pool is loaded directly
+func (m *PoolMatcherIP) Index() *GeoIndex {
+	return m.current().Index
+}
+
+// current - returns current pool of matcher, empty pool if matcher is closed
+func (m *PoolMatcherIP) current() *GeoPool {
 	if m.ctx.Err() != nil {
-		return false
+		return &GeoPool{Pool: &netipuse.PoolIP{}}
+	}
+	return m.state.current()
+}
+
+// Close - releases shared pool of matcher, closed matcher matches nothing
+func (m *PoolMatcherIP) Close() error {
+	m.cancel()
+	m.drop()
+	return nil
+}
+
+// drop - releases shared pool of matcher when its context is done
+func (m *PoolMatcherIP) drop() {
+	if m.release != nil {
+		m.release()
+	}
+}
+
+/*
+Locate - returns location of IP by geo matcher.
+
+	Matchers selected from GeoIndex locate any IP of source,
+	others locate only matched IPs.
+*/
+func (m *PoolMatcherIP) Locate(ip netip.Addr) (Geoname, bool) {
+	gp := m.current()
+	if gp.Index != nil {
+		return gp.Index.Locate(ip)
+	}
+	return gp.Locate(ip)
+}
+
+// Country - returns country ISO code of IP located by geo matcher
+func (m *PoolMatcherIP) Country(ip netip.Addr) (string, bool) {
+	g, ok := m.Locate(ip)
+	return g.CountryCode, ok && g.CountryCode != ""
+}
+
+/*
+MatchPrefix - returns network of matcher pool containing IP.
+
+	For geo matchers network is taken from location range of IP,
+	so neighbouring networks of other locations are not merged in.
+*/
+func (m *PoolMatcherIP) MatchPrefix(ip netip.Addr) (netip.Prefix, bool) {
+	gp := m.current()
+	pool, sets, index := gp.Pool, gp.Sets, gp.Index
+
+	r, ok := pool.RangeOf(ip)
+	if !ok {
+		return netip.Prefix{}, false
+	}
+
+	if index != nil {
+		if _, lr, found := index.LocateRange(ip); found {
+			r = lr
+		}
+	} else {
+		for _, set := range sets {
+			if lr, found := set.Pool.RangeOf(ip); found {
+				r = lr
+				break
+			}
+		}
+	}
+
+	for _, pf := range r.Prefixes() {
+		if pf.Contains(ip) {
+			return pf, true
+		}
 	}
-	return m.pool.Contains(ip)
+	return netip.Prefix{}, false
 }
 
 func (m *PoolMatcherIP) MatchParsed(s string) (bool, error) {
@@ -0,0 +1,66 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package ipmatch
+
+import (
+	"context"
+
+	"github.com/eterline/geo-filt/internal/adapter/v2dat"
+	"github.com/eterline/geo-filt/pkg/netipuse"
+)
+
+/*
+SelectGeoIPDat - builds IP pool of v2ray/Xray geoip.dat lists by country codes.
+
+	Special lists as 'private', 'telegram' etc. are selected by name as well.
+	Entries have no continent and EU membership data, so only
+	country selectors match them. Entries without ISO country code
+	are marked as lists, the index does not locate IPs to them.
+*/
+func SelectGeoIPDat(datFile string, codes []string) (*GeoPool, error) {
+	sel, err := ParseTags(codes)
+	if err != nil {
+		return nil, err
+	}
+	return selectGeoIPDat(datFile, sel)
+}
+
+func selectGeoIPDat(datFile string, sel TagSelector) (*GeoPool, error) {
+	file, err := resolvePath(datFile, true)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := v2dat.Open(file, func(code string) bool {
+		return sel.Match(Geoname{CountryCode: code})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pool := &geoPoolBuilder{}
+	for _, entry := range list {
+		pool.AddSet(Geoname{CountryCode: entry.CountryCode, List: !entry.IsCountry()}, geoIPSet(entry))
+	}
+
+	return pool.GeoPool()
+}
+
+// geoIPSet - converts geoip.dat entry to IP pool respecting reverse match
+func geoIPSet(entry v2dat.GeoIP) *netipuse.PoolIP {
+	set := &netipuse.PoolIPBuilder{}
+	for _, pf := range entry.CIDR {
+		set.AddPrefix(pf)
+	}
+	if entry.ReverseMatch {
+		set.Complement()
+	}
+	pool, _ := set.PoolIP()
+	return pool
+}
+
+func NewMatcherGeoIPDat(ctx context.Context, datFile string, codes []string) (*PoolMatcherIP, error) {
+	return NewMatcherGeoSource(ctx, GeoSource{DatFile: datFile}, codes)
+}
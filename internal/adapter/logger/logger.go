@@ -0,0 +1,79 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package logger
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+)
+
+// New - creates structured logger with level (debug, info, warn, error) and format (text, json)
+func New(w io.Writer, level string, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		lvl = slog.LevelDebug
+	case "", "info":
+		lvl = slog.LevelInfo
+	case "warn", "warning":
+		lvl = slog.LevelWarn
+	case "error":
+		lvl = slog.LevelError
+	default:
+		return nil, fmt.Errorf("invalid log level: %q", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("invalid log format: %q", format)
+}
+
+// Discard - returns logger which drops every record
+func Discard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// OrDiscard - returns log or discarding logger if log is nil
+func OrDiscard(log *slog.Logger) *slog.Logger {
+	if log == nil {
+		return Discard()
+	}
+	return log
+}
+
+/*
+Sampler - passes every n-th event.
+
+	Zero or one rate passes every event.
+	Sampler is safe for concurrent use.
+*/
+type Sampler struct {
+	rate    uint64
+	counter uint64
+}
+
+func NewSampler(rate int) *Sampler {
+	if rate < 1 {
+		rate = 1
+	}
+	return &Sampler{rate: uint64(rate)}
+}
+
+// Sample - reports whether event must be logged
+func (s *Sampler) Sample() bool {
+	if s == nil || s.rate <= 1 {
+		return true
+	}
+	return (atomic.AddUint64(&s.counter, 1)-1)%s.rate == 0
+}
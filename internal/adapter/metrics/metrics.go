@@ -0,0 +1,260 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ContentType - Prometheus text exposition format content type
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Collector - metric written in Prometheus text exposition format
+type Collector interface {
+	WriteText(w *bufio.Writer)
+}
+
+// Registry - set of collectors exposed together
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register - adds collectors to registry
+func (r *Registry) Register(cs ...Collector) {
+	r.mu.Lock()
+	r.collectors = append(r.collectors, cs...)
+	r.mu.Unlock()
+}
+
+// WriteText - writes every collector in Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	cs := append([]Collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range cs {
+		c.WriteText(bw)
+	}
+	return bw.Flush()
+}
+
+func (r *Registry) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Content-Type", ContentType)
+	rw.WriteHeader(http.StatusOK)
+	if req.Method == http.MethodHead {
+		return
+	}
+	r.WriteText(rw)
+}
+
+// ===========================
+
+// CounterVec - counter partitioned by label values
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.RWMutex
+	values map[string]*counterValue
+}
+
+type counterValue struct {
+	labels []string
+	n      uint64
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: map[string]*counterValue{},
+	}
+}
+
+// Inc - increments counter of label values
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add - adds n to counter of label values
+func (c *CounterVec) Add(n uint64, values ...string) {
+	if len(values) != len(c.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", c.name, len(c.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	c.mu.RLock()
+	v, ok := c.values[key]
+	c.mu.RUnlock()
+
+	if !ok {
+		c.mu.Lock()
+		v, ok = c.values[key]
+		if !ok {
+			v = &counterValue{labels: append([]string(nil), values...)}
+			c.values[key] = v
+		}
+		c.mu.Unlock()
+	}
+
+	atomic.AddUint64(&v.n, n)
+}
+
+func (c *CounterVec) WriteText(w *bufio.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+
+	c.mu.RLock()
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	values := make([]*counterValue, len(keys))
+	for i, k := range keys {
+		values[i] = c.values[k]
+	}
+	c.mu.RUnlock()
+
+	for _, v := range values {
+		w.WriteString(c.name)
+		writeLabels(w, c.labels, v.labels, "", "")
+		w.WriteByte(' ')
+		w.WriteString(strconv.FormatUint(atomic.LoadUint64(&v.n), 10))
+		w.WriteByte('\n')
+	}
+}
+
+// ===========================
+
+// Histogram - cumulative histogram of observed values
+type Histogram struct {
+	name    string
+	help    string
+	buckets []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram - creates histogram with ascending upper bounds of buckets
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &Histogram{
+		name:    name,
+		help:    help,
+		buckets: b,
+		counts:  make([]uint64, len(b)),
+	}
+}
+
+// Observe - adds value to histogram
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+
+	h.mu.Lock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+	h.mu.Unlock()
+}
+
+func (h *Histogram) WriteText(w *bufio.Writer) {
+	h.mu.Lock()
+	counts := append([]uint64(nil), h.counts...)
+	sum, count := h.sum, h.count
+	h.mu.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+
+	cumulative := uint64(0)
+	for i, le := range h.buckets {
+		cumulative += counts[i]
+		w.WriteString(h.name)
+		w.WriteString("_bucket")
+		writeLabels(w, nil, nil, "le", formatFloat(le))
+		w.WriteByte(' ')
+		w.WriteString(strconv.FormatUint(cumulative, 10))
+		w.WriteByte('\n')
+	}
+
+	w.WriteString(h.name)
+	w.WriteString("_bucket")
+	writeLabels(w, nil, nil, "le", "+Inf")
+	w.WriteByte(' ')
+	w.WriteString(strconv.FormatUint(count, 10))
+	w.WriteByte('\n')
+
+	w.WriteString(h.name + "_sum " + formatFloat(sum) + "\n")
+	w.WriteString(h.name + "_count " + strconv.FormatUint(count, 10) + "\n")
+}
+
+// ===========================
+
+func writeHeader(w *bufio.Writer, name, help, typ string) {
+	w.WriteString("# HELP " + name + " " + escapeHelp(help) + "\n")
+	w.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+func writeLabels(w *bufio.Writer, names, values []string, extraName, extraValue string) {
+	if len(names) == 0 && extraName == "" {
+		return
+	}
+	w.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(name + `="` + escapeLabel(values[i]) + `"`)
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(extraName + `="` + escapeLabel(extraValue) + `"`)
+	}
+	w.WriteByte('}')
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
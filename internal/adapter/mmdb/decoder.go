@@ -0,0 +1,231 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package mmdb
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// MaxMind DB data section field types
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+var errOutOfBounds = errors.New("mmdb: unexpected end of data section")
+
+/*
+decoder - MaxMind DB data section decoder.
+
+	Values are decoded to Go types:
+	map[string]any, []any, string, []byte, float64, float32,
+	uint64, int32, *big.Int (uint128) and bool.
+*/
+type decoder struct {
+	buf []byte
+}
+
+// ctrl - reads field control byte and size, returns type, size and payload offset
+func (d decoder) ctrl(offset uint) (typ int, size uint, next uint, err error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, 0, 0, errOutOfBounds
+	}
+	c := d.buf[offset]
+	next = offset + 1
+	typ = int(c >> 5)
+
+	if typ == typePointer {
+		return typ, uint(c), next, nil
+	}
+
+	if typ == typeExtended {
+		if next >= uint(len(d.buf)) {
+			return 0, 0, 0, errOutOfBounds
+		}
+		typ = int(d.buf[next]) + 7
+		next++
+		if typ < typeInt32 || typ > typeFloat {
+			return 0, 0, 0, fmt.Errorf("mmdb: invalid extended type %d at %d", typ, offset)
+		}
+	}
+
+	size = uint(c & 0x1f)
+	if size < 29 {
+		return typ, size, next, nil
+	}
+
+	n := size - 28
+	if next+n > uint(len(d.buf)) {
+		return 0, 0, 0, errOutOfBounds
+	}
+	v := uint(0)
+	for _, b := range d.buf[next : next+n] {
+		v = v<<8 | uint(b)
+	}
+	next += n
+
+	switch size {
+	case 29:
+		size = 29 + v
+	case 30:
+		size = 285 + v
+	default:
+		size = 65821 + v
+	}
+	return typ, size, next, nil
+}
+
+// pointer - resolves pointer field, ctrl is the raw control byte
+func (d decoder) pointer(ctrl uint, offset uint) (target uint, next uint, err error) {
+	n := ((ctrl >> 3) & 0x3) + 1
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, errOutOfBounds
+	}
+
+	v := uint(0)
+	if n != 4 {
+		v = ctrl & 0x7
+	}
+	for _, b := range d.buf[offset : offset+n] {
+		v = v<<8 | uint(b)
+	}
+
+	switch n {
+	case 2:
+		v += 2048
+	case 3:
+		v += 526336
+	}
+	return v, offset + n, nil
+}
+
+// decode - decodes value at offset, returns value and offset of next field
+func (d decoder) decode(offset uint) (any, uint, error) {
+	return d.decodeDepth(offset, 0)
+}
+
+func (d decoder) decodeDepth(offset uint, depth int) (any, uint, error) {
+	if depth > 512 {
+		return nil, 0, errors.New("mmdb: data structure nesting is too deep")
+	}
+
+	typ, size, next, err := d.ctrl(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typ == typePointer {
+		target, after, err := d.pointer(size, next)
+		if err != nil {
+			return nil, 0, err
+		}
+		v, _, err := d.decodeDepth(target, depth+1)
+		return v, after, err
+	}
+
+	switch typ {
+	case typeMap:
+		m := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			k, n, err := d.decodeDepth(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("mmdb: map key at %d is not a string", next)
+			}
+			v, n, err := d.decodeDepth(n, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+			next = n
+		}
+		return m, next, nil
+
+	case typeArray:
+		a := make([]any, 0, size)
+		for i := uint(0); i < size; i++ {
+			v, n, err := d.decodeDepth(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			next = n
+		}
+		return a, next, nil
+
+	case typeBool:
+		// comparison is not returned as any directly, Yaegi fails on it
+		on := size != 0
+		return on, next, nil
+
+	case typeContainer, typeEndMarker:
+		return nil, next, nil
+	}
+
+	if next+size > uint(len(d.buf)) {
+		return nil, 0, errOutOfBounds
+	}
+	b := d.buf[next : next+size]
+	next += size
+
+	switch typ {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes:
+		return append([]byte(nil), b...), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("mmdb: invalid double size %d", size)
+		}
+		return math.Float64frombits(uintOf(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("mmdb: invalid float size %d", size)
+		}
+		return math.Float32frombits(uint32(uintOf(b))), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("mmdb: invalid unsigned size %d", size)
+		}
+		return uintOf(b), next, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("mmdb: invalid int32 size %d", size)
+		}
+		return int32(uint32(uintOf(b))), next, nil
+	case typeUint128:
+		return new(big.Int).SetBytes(b), next, nil
+	}
+
+	return nil, 0, fmt.Errorf("mmdb: unknown field type %d at %d", typ, offset)
+}
+
+func uintOf(b []byte) uint64 {
+	v := uint64(0)
+	for _, x := range b {
+		v = v<<8 | uint64(x)
+	}
+	return v
+}
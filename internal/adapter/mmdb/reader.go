@@ -0,0 +1,291 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package mmdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+)
+
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// Metadata - MaxMind DB file metadata
+type Metadata struct {
+	NodeCount    uint
+	RecordSize   uint
+	IPVersion    uint
+	DatabaseType string
+	BuildEpoch   uint64
+	Languages    []string
+}
+
+/*
+Reader - pure Go MaxMind DB file reader.
+
+	Reads the whole file to memory and walks
+	the binary search tree without cgo or mmap.
+*/
+type Reader struct {
+	buf      []byte
+	meta     Metadata
+	data     decoder
+	treeSize uint
+	ipv4Node uint
+}
+
+// Open - reads MaxMind DB file
+func Open(file string) (*Reader, error) {
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return FromBytes(buf)
+}
+
+// FromBytes - creates reader of MaxMind DB file contents
+func FromBytes(buf []byte) (*Reader, error) {
+	start := bytes.LastIndex(buf, metadataMarker)
+	if start < 0 {
+		return nil, errors.New("mmdb: metadata marker not found, invalid database file")
+	}
+	start += len(metadataMarker)
+
+	raw, _, err := decoder{buf: buf[start:]}.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("mmdb: invalid metadata: %w", err)
+	}
+	m, ok := raw.(map[string]any)
+	if !ok {
+		return nil, errors.New("mmdb: metadata is not a map")
+	}
+
+	meta := Metadata{
+		NodeCount:    uint(uintField(m, "node_count")),
+		RecordSize:   uint(uintField(m, "record_size")),
+		IPVersion:    uint(uintField(m, "ip_version")),
+		BuildEpoch:   uintField(m, "build_epoch"),
+		DatabaseType: stringField(m, "database_type"),
+	}
+	if langs, ok := m["languages"].([]any); ok {
+		for _, l := range langs {
+			if s, ok := l.(string); ok {
+				meta.Languages = append(meta.Languages, s)
+			}
+		}
+	}
+
+	if major := uintField(m, "binary_format_major_version"); major != 2 {
+		return nil, fmt.Errorf("mmdb: unsupported binary format version %d", major)
+	}
+
+	switch meta.RecordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("mmdb: unsupported record size %d", meta.RecordSize)
+	}
+
+	if meta.IPVersion != 4 && meta.IPVersion != 6 {
+		return nil, fmt.Errorf("mmdb: unsupported ip version %d", meta.IPVersion)
+	}
+
+	treeSize := meta.NodeCount * meta.RecordSize / 4
+	dataStart := treeSize + 16
+	dataEnd := uint(start - len(metadataMarker))
+	if dataStart > dataEnd {
+		return nil, errors.New("mmdb: search tree is larger than file")
+	}
+
+	r := &Reader{
+		buf:      buf,
+		meta:     meta,
+		data:     decoder{buf: buf[dataStart:dataEnd]},
+		treeSize: treeSize,
+	}
+
+	// IPv4 addresses are stored in ::/96 subtree of IPv6 databases
+	if meta.IPVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < meta.NodeCount; i++ {
+			node = r.record(node, 0)
+		}
+		r.ipv4Node = node
+	}
+
+	return r, nil
+}
+
+// Metadata - returns database metadata
+func (r *Reader) Metadata() Metadata {
+	return r.meta
+}
+
+// record - reads left (bit 0) or right (bit 1) record of node
+func (r *Reader) record(node uint, bit uint) uint {
+	switch r.meta.RecordSize {
+	case 24:
+		o := node*6 + bit*3
+		b := r.buf[o : o+3]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		o := node * 7
+		b := r.buf[o : o+7]
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		o := node*8 + bit*4
+		b := r.buf[o : o+4]
+		return uint(b[0])<<24 | uint(b[1])<<16 | uint(b[2])<<8 | uint(b[3])
+	}
+}
+
+// dataOffset - converts tree record pointer to data section offset
+func (r *Reader) dataOffset(rec uint) (uint, error) {
+	off := rec - r.meta.NodeCount - 16
+	if rec < r.meta.NodeCount+16 || off >= uint(len(r.data.buf)) {
+		return 0, fmt.Errorf("mmdb: invalid data pointer %d in search tree", rec)
+	}
+	return off, nil
+}
+
+/*
+Lookup - searches IP in tree.
+
+	Returns data section offset of record and network of IP.
+	ok is false if IP is not in database.
+*/
+func (r *Reader) Lookup(ip netip.Addr) (offset uint, network netip.Prefix, ok bool, err error) {
+	if !ip.IsValid() {
+		return 0, netip.Prefix{}, false, errors.New("mmdb: invalid ip address")
+	}
+	ip = ip.Unmap()
+
+	node, bits := uint(0), ip.BitLen()
+	if ip.Is4() && r.meta.IPVersion == 6 {
+		node = r.ipv4Node
+	}
+	if ip.Is6() && r.meta.IPVersion == 4 {
+		return 0, netip.Prefix{}, false, nil
+	}
+
+	raw := ip.AsSlice()
+	depth := 0
+	for ; depth < bits && node < r.meta.NodeCount; depth++ {
+		bit := uint(raw[depth>>3]>>(7-uint(depth&7))) & 1
+		node = r.record(node, bit)
+	}
+
+	network, _ = ip.Prefix(depth)
+	if node == r.meta.NodeCount {
+		return 0, network, false, nil
+	}
+	if node < r.meta.NodeCount {
+		return 0, netip.Prefix{}, false, errors.New("mmdb: invalid search tree, ip bits exhausted")
+	}
+
+	offset, err = r.dataOffset(node)
+	if err != nil {
+		return 0, netip.Prefix{}, false, err
+	}
+	return offset, network, true, nil
+}
+
+// Decode - decodes data section record at offset
+func (r *Reader) Decode(offset uint) (any, error) {
+	v, _, err := r.data.decode(offset)
+	return v, err
+}
+
+type walkNode struct {
+	node  uint
+	depth int
+	ip    [16]byte
+}
+
+/*
+Networks - walks every network of database in ascending order.
+
+	IPv4 networks of IPv6 databases are reported as IPv4 prefixes,
+	aliases of IPv4 subtree (::ffff:0:0/96, 2002::/16) are skipped.
+*/
+func (r *Reader) Networks(fn func(network netip.Prefix, offset uint) error) error {
+	bits := 128
+	if r.meta.IPVersion == 4 {
+		bits = 32
+	}
+
+	stack := []walkNode{{node: 0}}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if n.node > r.meta.NodeCount {
+			offset, err := r.dataOffset(n.node)
+			if err != nil {
+				return err
+			}
+			if err := fn(r.prefixOf(n, bits), offset); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if n.node == r.meta.NodeCount || n.depth >= bits {
+			continue
+		}
+
+		// aliased IPv4 subtree reached not from ::/96
+		if r.meta.IPVersion == 6 && n.node == r.ipv4Node && r.ipv4Node != 0 && !(n.depth == 96 && isZero(n.ip[:12])) {
+			continue
+		}
+
+		right := n
+		right.depth++
+		right.ip[n.depth>>3] |= 1 << (7 - uint(n.depth&7))
+		right.node = r.record(n.node, 1)
+
+		left := n
+		left.depth++
+		left.node = r.record(n.node, 0)
+
+		// push right first to walk left side first
+		stack = append(stack, right, left)
+	}
+	return nil
+}
+
+// prefixOf - converts walk node to IPv4 or IPv6 prefix
+func (r *Reader) prefixOf(n walkNode, bits int) netip.Prefix {
+	if bits == 32 {
+		return netip.PrefixFrom(netip.AddrFrom4([4]byte(n.ip[:4])), n.depth)
+	}
+	if n.depth >= 96 && isZero(n.ip[:12]) {
+		return netip.PrefixFrom(netip.AddrFrom4([4]byte(n.ip[12:])), n.depth-96)
+	}
+	return netip.PrefixFrom(netip.AddrFrom16(n.ip), n.depth)
+}
+
+func isZero(b []byte) bool {
+	for _, x := range b {
+		if x != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func uintField(m map[string]any, key string) uint64 {
+	v, _ := m[key].(uint64)
+	return v
+}
+
+func stringField(m map[string]any, key string) string {
+	v, _ := m[key].(string)
+	return v
+}
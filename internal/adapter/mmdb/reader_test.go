@@ -0,0 +1,358 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package mmdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/netip"
+	"testing"
+)
+
+// testRecord - search tree record: empty, node or data
+type testRecord struct {
+	kind int
+	v    uint
+}
+
+const (
+	recordEmpty = iota
+	recordNode
+	recordData
+)
+
+// testDB - writer of MaxMind DB files for tests
+type testDB struct {
+	ipVersion  uint
+	recordSize uint
+	padding    uint // unused data bytes before records, makes pointers wider than 24 bits
+	nodes      [][2]testRecord
+	data       []byte
+}
+
+func newTestDB(ipVersion, recordSize, padding uint) *testDB {
+	return &testDB{
+		ipVersion:  ipVersion,
+		recordSize: recordSize,
+		padding:    padding,
+		nodes:      [][2]testRecord{{}},
+		data:       make([]byte, padding),
+	}
+}
+
+// path - returns bits of network in tree, IPv4 networks of IPv6 tree are in ::/96
+func (db *testDB) path(pf netip.Prefix) []uint {
+	raw, bits := pf.Addr().AsSlice(), pf.Bits()
+	if pf.Addr().Is4() && db.ipVersion == 6 {
+		raw, bits = append(make([]byte, 12), raw...), bits+96
+	}
+	path := make([]uint, bits)
+	for i := range path {
+		path[i] = uint(raw[i>>3]>>(7-uint(i&7))) & 1
+	}
+	return path
+}
+
+// set - sets record at the end of path, creating nodes on the way
+func (db *testDB) set(path []uint, rec testRecord) {
+	node := 0
+	for _, bit := range path[:len(path)-1] {
+		next := db.nodes[node][bit]
+		if next.kind != recordNode {
+			db.nodes = append(db.nodes, [2]testRecord{})
+			next = testRecord{kind: recordNode, v: uint(len(db.nodes) - 1)}
+			db.nodes[node][bit] = next
+		}
+		node = int(next.v)
+	}
+	db.nodes[node][path[len(path)-1]] = rec
+}
+
+// insert - adds network with record data
+func (db *testDB) insert(pf netip.Prefix, data []byte) {
+	db.set(db.path(pf), testRecord{kind: recordData, v: uint(len(db.data))})
+	db.data = append(db.data, data...)
+}
+
+// alias - points network to node of IPv4 subtree as MaxMind writer does
+func (db *testDB) alias(pf netip.Prefix) {
+	node := uint(0)
+	for _, bit := range db.path(netip.MustParsePrefix("::/96")) {
+		node = db.nodes[node][bit].v
+	}
+	db.set(db.path(pf), testRecord{kind: recordNode, v: node})
+}
+
+func (db *testDB) bytes() []byte {
+	count := uint(len(db.nodes))
+	value := func(r testRecord) uint {
+		switch r.kind {
+		case recordNode:
+			return r.v
+		case recordData:
+			return count + 16 + r.v
+		}
+		return count
+	}
+
+	buf := &bytes.Buffer{}
+	for _, n := range db.nodes {
+		l, r := value(n[0]), value(n[1])
+		switch db.recordSize {
+		case 24:
+			buf.Write([]byte{byte(l >> 16), byte(l >> 8), byte(l), byte(r >> 16), byte(r >> 8), byte(r)})
+		case 28:
+			buf.Write([]byte{byte(l >> 16), byte(l >> 8), byte(l), byte(l>>24)<<4 | byte(r>>24)&0x0f, byte(r >> 16), byte(r >> 8), byte(r)})
+		default:
+			buf.Write([]byte{byte(l >> 24), byte(l >> 16), byte(l >> 8), byte(l), byte(r >> 24), byte(r >> 16), byte(r >> 8), byte(r)})
+		}
+	}
+	buf.Write(make([]byte, 16))
+	buf.Write(db.data)
+
+	buf.Write(metadataMarker)
+	buf.Write(encMap(
+		"binary_format_major_version", encUint(5, 2),
+		"binary_format_minor_version", encUint(5, 0),
+		"node_count", encUint(6, uint64(count)),
+		"record_size", encUint(5, uint64(db.recordSize)),
+		"ip_version", encUint(5, uint64(db.ipVersion)),
+		"database_type", encString("Test-Country"),
+		"build_epoch", append([]byte{0x08, 9 - 7}, be(1700000000, 8)...),
+		"languages", append([]byte{0x02, 11 - 7}, append(encString("en"), encString("ru")...)...),
+	))
+	return buf.Bytes()
+}
+
+// data section encoders of short values
+
+func encString(s string) []byte {
+	return append([]byte{0x40 | byte(len(s))}, s...)
+}
+
+func encUint(typ byte, v uint64) []byte {
+	n := 0
+	for x := v; x > 0; x >>= 8 {
+		n++
+	}
+	return append([]byte{typ<<5 | byte(n)}, be(v, n)...)
+}
+
+func encMap(kv ...any) []byte {
+	b := []byte{0xe0 | byte(len(kv)/2)}
+	for i := 0; i < len(kv); i += 2 {
+		b = append(b, encString(kv[i].(string))...)
+		b = append(b, kv[i+1].([]byte)...)
+	}
+	return b
+}
+
+func be(v uint64, n int) []byte {
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return b
+}
+
+func countryRecord(code string, id uint64) []byte {
+	return encMap("country", encMap("iso_code", encString(code), "geoname_id", encUint(6, id)))
+}
+
+func recordCountry(t *testing.T, r *Reader, offset uint) string {
+	t.Helper()
+
+	v, err := r.Decode(offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	country, _ := v.(map[string]any)["country"].(map[string]any)
+	code, _ := country["iso_code"].(string)
+	return code
+}
+
+func TestReaderRoundTrip(t *testing.T) {
+	networks := []struct {
+		prefix  string
+		country string
+	}{
+		{"1.0.0.0/24", "AU"},
+		{"1.0.1.0/24", "CN"},
+		{"8.8.8.0/24", "US"},
+		{"128.0.0.0/1", "DE"},
+		{"2001:db8::/32", "NL"},
+		{"2a00::/12", "FR"},
+	}
+
+	for _, ipVersion := range []uint{4, 6} {
+		for _, recordSize := range []uint{24, 28, 32} {
+			padding := uint(0)
+			if recordSize > 24 {
+				padding = 1 << 24
+			}
+			t.Run(fmt.Sprintf("ipv%d/%d", ipVersion, recordSize), func(t *testing.T) {
+				db := newTestDB(ipVersion, recordSize, padding)
+				want := map[netip.Prefix]string{}
+				for i, n := range networks {
+					pf := netip.MustParsePrefix(n.prefix)
+					if pf.Addr().Is6() && ipVersion == 4 {
+						continue
+					}
+					db.insert(pf, countryRecord(n.country, uint64(i+1)))
+					want[pf] = n.country
+				}
+				if ipVersion == 6 {
+					db.alias(netip.MustParsePrefix("::ffff:0:0/96"))
+					db.alias(netip.MustParsePrefix("2002::/16"))
+				}
+
+				r, err := FromBytes(db.bytes())
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				meta := r.Metadata()
+				if meta.RecordSize != recordSize || meta.IPVersion != ipVersion || meta.DatabaseType != "Test-Country" ||
+					meta.BuildEpoch != 1700000000 || len(meta.Languages) != 2 {
+					t.Errorf("Metadata = %+v", meta)
+				}
+
+				got := map[netip.Prefix]string{}
+				var order []netip.Prefix
+				err = r.Networks(func(network netip.Prefix, offset uint) error {
+					if _, dup := got[network]; dup {
+						return fmt.Errorf("network %s is walked twice", network)
+					}
+					got[network] = recordCountry(t, r, offset)
+					order = append(order, network)
+					return nil
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(got) != len(want) {
+					t.Errorf("Networks = %v, want %v", got, want)
+				}
+				for pf, c := range want {
+					if got[pf] != c {
+						t.Errorf("Networks %s = %q, want %q", pf, got[pf], c)
+					}
+				}
+				for i := 1; i < len(order); i++ {
+					if !order[i-1].Addr().Less(order[i].Addr()) {
+						t.Errorf("Networks order %s before %s", order[i-1], order[i])
+					}
+				}
+
+				lookups := []struct {
+					ip      string
+					country string
+					network string
+				}{
+					{"1.0.1.77", "CN", "1.0.1.0/24"},
+					{"200.1.2.3", "DE", "128.0.0.0/1"},
+					{"9.9.9.9", "", ""},
+				}
+				if ipVersion == 6 {
+					lookups = append(lookups, []struct {
+						ip      string
+						country string
+						network string
+					}{
+						{"2001:db8::1", "NL", "2001:db8::/32"},
+						{"::ffff:8.8.8.8", "US", "8.8.8.0/24"},
+						{"2a0f::1", "FR", "2a00::/12"},
+						{"2001:db9::1", "", ""},
+					}...)
+				}
+
+				for _, l := range lookups {
+					offset, network, ok, err := r.Lookup(netip.MustParseAddr(l.ip))
+					if err != nil {
+						t.Fatal(err)
+					}
+					if ok != (l.country != "") {
+						t.Errorf("Lookup(%s) ok = %v", l.ip, ok)
+						continue
+					}
+					if !ok {
+						continue
+					}
+					if c := recordCountry(t, r, offset); c != l.country || network.String() != l.network {
+						t.Errorf("Lookup(%s) = %s %s, want %s %s", l.ip, c, network, l.country, l.network)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestDecoderPointer(t *testing.T) {
+	// map with value pointing to string decoded before it
+	data := encString("shared")
+	data = append(data, encMap("a", []byte{0x20, 0x00}, "b", encUint(5, 7))...)
+
+	v, next, err := decoder{buf: data}.decode(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := v.(map[string]any)
+	if m["a"] != "shared" || m["b"] != uint64(7) || next != uint(len(data)) {
+		t.Errorf("decode = %v, next %d", m, next)
+	}
+}
+
+func TestFromBytesInvalid(t *testing.T) {
+	valid := func() *testDB {
+		db := newTestDB(4, 24, 0)
+		db.insert(netip.MustParsePrefix("1.0.0.0/24"), countryRecord("AU", 1))
+		return db
+	}
+
+	good := valid().bytes()
+	if _, err := FromBytes(good); err != nil {
+		t.Fatal(err)
+	}
+
+	marker := bytes.LastIndex(good, metadataMarker)
+	tests := []struct {
+		name string
+		buf  []byte
+	}{
+		{"empty", nil},
+		{"no metadata", good[:marker]},
+		{"truncated metadata", good[:marker+len(metadataMarker)+5]},
+		{"truncated tree", append(append([]byte{}, good[:2]...), good[marker:]...)},
+		{"record size", bytes.Replace(append([]byte{}, good...), encUint(5, 24), encUint(5, 20), 1)},
+	}
+
+	for _, tt := range tests {
+		if _, err := FromBytes(tt.buf); err == nil {
+			t.Errorf("%s: FromBytes succeeds", tt.name)
+		}
+	}
+
+	// data pointer beyond data section
+	db := valid()
+	db.nodes[0][0] = testRecord{kind: recordData, v: 1000}
+	r, err := FromBytes(db.bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := r.Lookup(netip.MustParseAddr("1.0.0.1")); err == nil {
+		t.Error("Lookup of invalid data pointer succeeds")
+	}
+	if err := r.Networks(func(netip.Prefix, uint) error { return nil }); err == nil {
+		t.Error("Networks of invalid data pointer succeeds")
+	}
+
+	// truncated record
+	if _, _, err := (decoder{buf: encString("shared")[:3]}).decode(0); !errors.Is(err, errOutOfBounds) {
+		t.Errorf("decode of truncated string = %v", err)
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package v2dat
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+/*
+GeoIP - v2ray/Xray geoip.dat list entry
+
+	message GeoIP {
+	  string country_code = 1;
+	  repeated CIDR cidr = 2;
+	  bool reverse_match = 3;
+	}
+*/
+type GeoIP struct {
+	CountryCode  string
+	CIDR         []netip.Prefix
+	ReverseMatch bool
+}
+
+// IsCountry - reports whether entry is country list with ISO 3166-1 alpha-2 code, not special list as 'private' or 'google'
+func (e GeoIP) IsCountry() bool {
+	if len(e.CountryCode) != 2 {
+		return false
+	}
+	for i := 0; i < len(e.CountryCode); i++ {
+		if c := e.CountryCode[i]; c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// Open - reads geoip.dat file, keep selects entries by country code
+func Open(file string, keep func(code string) bool) ([]GeoIP, error) {
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(buf, keep)
+}
+
+/*
+Decode - decodes GeoIPList protobuf message.
+
+	message GeoIPList {
+	  repeated GeoIP entry = 1;
+	}
+
+	CIDRs are decoded only for entries selected by keep.
+	If keep is nil, every entry is decoded.
+*/
+func Decode(buf []byte, keep func(code string) bool) ([]GeoIP, error) {
+	list := []GeoIP{}
+	err := fields(buf, func(num int, wire int, val uint64, b []byte) error {
+		if num != 1 || wire != wireBytes {
+			return nil
+		}
+		entry, ok, err := decodeGeoIP(b, keep)
+		if err != nil {
+			return err
+		}
+		if ok {
+			list = append(list, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("geoip.dat: %w", err)
+	}
+	return list, nil
+}
+
+func decodeGeoIP(buf []byte, keep func(code string) bool) (GeoIP, bool, error) {
+	var (
+		entry GeoIP
+		cidrs [][]byte
+	)
+
+	err := fields(buf, func(num int, wire int, val uint64, b []byte) error {
+		switch {
+		case num == 1 && wire == wireBytes:
+			entry.CountryCode = strings.ToUpper(string(b))
+		case num == 2 && wire == wireBytes:
+			cidrs = append(cidrs, b)
+		case num == 3 && wire == wireVarint:
+			entry.ReverseMatch = val != 0
+		}
+		return nil
+	})
+	if err != nil {
+		return GeoIP{}, false, err
+	}
+
+	if keep != nil && !keep(entry.CountryCode) {
+		return GeoIP{}, false, nil
+	}
+
+	entry.CIDR = make([]netip.Prefix, 0, len(cidrs))
+	for _, c := range cidrs {
+		pf, err := decodeCIDR(c)
+		if err != nil {
+			return GeoIP{}, false, fmt.Errorf("entry %s: %w", entry.CountryCode, err)
+		}
+		entry.CIDR = append(entry.CIDR, pf)
+	}
+
+	return entry, true, nil
+}
+
+/*
+decodeCIDR - decodes CIDR message
+
+	message CIDR {
+	  bytes ip = 1;
+	  uint32 prefix = 2;
+	}
+*/
+func decodeCIDR(buf []byte) (netip.Prefix, error) {
+	var (
+		ip   netip.Addr
+		bits uint64
+	)
+
+	err := fields(buf, func(num int, wire int, val uint64, b []byte) error {
+		switch {
+		case num == 1 && wire == wireBytes:
+			addr, ok := netip.AddrFromSlice(b)
+			if !ok {
+				return fmt.Errorf("invalid cidr ip length %d", len(b))
+			}
+			ip = addr.Unmap()
+		case num == 2 && wire == wireVarint:
+			bits = val
+		}
+		return nil
+	})
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	if !ip.IsValid() {
+		return netip.Prefix{}, errors.New("cidr without ip")
+	}
+
+	// IPv4-mapped entries keep IPv6 prefix length
+	if ip.Is4() && bits > 32 && bits <= 128 {
+		bits -= 96
+	}
+	if bits > uint64(ip.BitLen()) {
+		return netip.Prefix{}, fmt.Errorf("invalid cidr prefix %s/%d", ip, bits)
+	}
+
+	return netip.PrefixFrom(ip, int(bits)).Masked(), nil
+}
+
+// fields - walks protobuf message fields
+func fields(buf []byte, fn func(num int, wire int, val uint64, b []byte) error) error {
+	for len(buf) > 0 {
+		key, n := varint(buf)
+		if n <= 0 {
+			return errors.New("invalid field key")
+		}
+		buf = buf[n:]
+
+		num, wire := int(key>>3), int(key&7)
+		var (
+			val uint64
+			b   []byte
+		)
+
+		switch wire {
+		case wireVarint:
+			val, n = varint(buf)
+			if n <= 0 {
+				return errors.New("invalid varint")
+			}
+			buf = buf[n:]
+		case wireFixed64:
+			if len(buf) < 8 {
+				return errors.New("unexpected end of fixed64")
+			}
+			buf = buf[8:]
+		case wireFixed32:
+			if len(buf) < 4 {
+				return errors.New("unexpected end of fixed32")
+			}
+			buf = buf[4:]
+		case wireBytes:
+			l, n := varint(buf)
+			if n <= 0 || uint64(len(buf)-n) < l {
+				return errors.New("invalid length delimited field")
+			}
+			b = buf[n : n+int(l)]
+			buf = buf[n+int(l):]
+		default:
+			return fmt.Errorf("unsupported wire type %d", wire)
+		}
+
+		if err := fn(num, wire, val, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// varint - decodes protobuf varint, n <= 0 on error
+func varint(buf []byte) (uint64, int) {
+	// named result is not zeroed between calls under Yaegi
+	var v uint64
+	for i, b := range buf {
+		if i == 10 {
+			return 0, -1
+		}
+		v |= uint64(b&0x7f) << (7 * uint(i))
+		if b < 0x80 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package v2dat
+
+import (
+	"bytes"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// protobuf encoders of test messages
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendBytes(b []byte, num int, v []byte) []byte {
+	b = appendVarint(b, uint64(num<<3|wireBytes))
+	b = appendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendUint(b []byte, num int, v uint64) []byte {
+	b = appendVarint(b, uint64(num<<3|wireVarint))
+	return appendVarint(b, v)
+}
+
+func encCIDR(ip string, bits uint64) []byte {
+	return appendUint(appendBytes(nil, 1, netip.MustParseAddr(ip).AsSlice()), 2, bits)
+}
+
+func encGeoIP(code string, reverse bool, cidrs ...[]byte) []byte {
+	b := appendBytes(nil, 1, []byte(code))
+	for _, c := range cidrs {
+		b = appendBytes(b, 2, c)
+	}
+	if reverse {
+		b = appendUint(b, 3, 1)
+	}
+	return b
+}
+
+func encList(entries ...[]byte) []byte {
+	var b []byte
+	for _, e := range entries {
+		b = appendBytes(b, 1, e)
+	}
+	return b
+}
+
+func testList() []byte {
+	ru := encGeoIP("ru", false,
+		encCIDR("5.3.0.0", 16),
+		encCIDR("5.8.9.77", 24),
+		encCIDR("2a00:1fa0::", 29),
+	)
+	// unknown fields of every wire type are skipped
+	ru = appendUint(ru, 9, 300)
+	ru = append(appendVarint(ru, 10<<3|wireFixed64), make([]byte, 8)...)
+	ru = append(appendVarint(ru, 11<<3|wireFixed32), make([]byte, 4)...)
+
+	private := encGeoIP("PRIVATE", true,
+		encCIDR("::ffff:10.0.0.0", 104),
+		encCIDR("fc00::", 7),
+	)
+
+	return append(encList(ru, private), appendBytes(nil, 2, []byte("ignored"))...)
+}
+
+func TestDecode(t *testing.T) {
+	list, err := Decode(testList(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []GeoIP{
+		{
+			CountryCode: "RU",
+			CIDR: []netip.Prefix{
+				netip.MustParsePrefix("5.3.0.0/16"),
+				netip.MustParsePrefix("5.8.9.0/24"),
+				netip.MustParsePrefix("2a00:1fa0::/29"),
+			},
+		},
+		{
+			CountryCode: "PRIVATE",
+			CIDR: []netip.Prefix{
+				netip.MustParsePrefix("10.0.0.0/8"),
+				netip.MustParsePrefix("fc00::/7"),
+			},
+			ReverseMatch: true,
+		},
+	}
+	if !reflect.DeepEqual(list, want) {
+		t.Errorf("Decode = %v, want %v", list, want)
+	}
+}
+
+func TestIsCountry(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{"US", true},
+		{"RU", true},
+		{"PRIVATE", false},
+		{"GOOGLE", false},
+		{"CN2", false},
+		{"U1", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := (GeoIP{CountryCode: tt.code}).IsCountry(); got != tt.want {
+			t.Errorf("IsCountry(%q) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeKeep(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "geoip.dat")
+	if err := os.WriteFile(file, testList(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var seen []string
+	list, err := Open(file, func(code string) bool {
+		seen = append(seen, code)
+		return code == "PRIVATE"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(seen, []string{"RU", "PRIVATE"}) {
+		t.Errorf("keep is called for %v", seen)
+	}
+	if len(list) != 1 || list[0].CountryCode != "PRIVATE" || len(list[0].CIDR) != 2 {
+		t.Errorf("Open = %v, want PRIVATE entry", list)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	good := testList()
+
+	tests := []struct {
+		name string
+		buf  []byte
+	}{
+		{"truncated list", good[:len(good)-3]},
+		{"truncated key", []byte{0x80}},
+		{"truncated varint", []byte{3<<3 | wireVarint}},
+		{"long varint", append([]byte{3<<3 | wireVarint}, bytes.Repeat([]byte{0xff}, 11)...)},
+		{"length beyond buffer", []byte{1<<3 | wireBytes, 0x7f, 0x00}},
+		{"unsupported wire type", []byte{1<<3 | 3}},
+		{"truncated fixed64", append(appendVarint(nil, 2<<3|wireFixed64), 0, 0)},
+		{"cidr without ip", encList(encGeoIP("US", false, appendUint(nil, 2, 24)))},
+		{"cidr ip length", encList(encGeoIP("US", false, appendUint(appendBytes(nil, 1, []byte{1, 2, 3}), 2, 8)))},
+		{"ipv4 prefix", encList(encGeoIP("US", false, encCIDR("1.2.3.0", 33)))},
+		{"ipv6 prefix", encList(encGeoIP("US", false, encCIDR("2001:db8::", 129)))},
+		{"truncated cidr", encList(encGeoIP("US", false, encCIDR("1.2.3.0", 24)[:4]))},
+	}
+
+	for _, tt := range tests {
+		if list, err := Decode(tt.buf, nil); err == nil {
+			t.Errorf("%s: Decode = %v, want error", tt.name, list)
+		}
+	}
+
+	// invalid CIDRs of skipped entries are not decoded
+	buf := encList(encGeoIP("US", false, encCIDR("1.2.3.0", 33)))
+	if _, err := Decode(buf, func(string) bool { return false }); err != nil {
+		t.Errorf("Decode of skipped entry: %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package bypass
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// minSecretLen - minimal length of token signing secret
+const minSecretLen = 16
+
+// bypass credential errors
+var (
+	ErrMalformed = errors.New("malformed bypass token")
+	ErrSignature = errors.New("invalid bypass token signature")
+	ErrExpired   = errors.New("bypass token expired")
+	ErrUnknown   = errors.New("unknown bypass credential")
+)
+
+// claims - signed payload of bypass token
+type claims struct {
+	Subject string `json:"sub"`
+	Expiry  int64  `json:"exp"` // unix seconds
+}
+
+// apiKey - static bypass key with its subject
+type apiKey struct {
+	subject string
+	key     []byte
+}
+
+/*
+Verifier - checks bypass credentials of requests.
+
+	Token is base64url(JSON {"sub","exp"}) "." base64url(HMAC-SHA256 of payload part),
+	signed with shared secret. API keys are static strings "subject:key" or "key".
+	Verifier is immutable and safe for concurrent use.
+*/
+type Verifier struct {
+	secret []byte
+	keys   []apiKey
+}
+
+// NewVerifier - creates verifier of tokens signed by secret and static API keys, secret may be empty
+func NewVerifier(secret string, keys []string) (*Verifier, error) {
+	if secret != "" && len(secret) < minSecretLen {
+		return nil, fmt.Errorf("bypass secret must be at least %d characters", minSecretLen)
+	}
+
+	v := &Verifier{secret: []byte(secret)}
+	for i, s := range keys {
+		subject, key, ok := strings.Cut(strings.TrimSpace(s), ":")
+		if !ok {
+			subject, key = fmt.Sprintf("api-key-%d", i+1), subject
+		}
+		if key == "" {
+			return nil, fmt.Errorf("bypass key %d is empty", i+1)
+		}
+		v.keys = append(v.keys, apiKey{subject: subject, key: []byte(key)})
+	}
+
+	if len(v.secret) == 0 && len(v.keys) == 0 {
+		return nil, errors.New("bypass secret and keys are empty")
+	}
+	return v, nil
+}
+
+// Issue - creates token of subject valid until expiry
+func (v *Verifier) Issue(subject string, expiry time.Time) (string, error) {
+	if len(v.secret) == 0 {
+		return "", errors.New("bypass secret is not set")
+	}
+	if subject == "" {
+		return "", errors.New("bypass token subject is empty")
+	}
+
+	payload, err := json.Marshal(claims{Subject: subject, Expiry: expiry.Unix()})
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding.EncodeToString(payload)
+	return enc + "." + base64.RawURLEncoding.EncodeToString(v.sign(enc)), nil
+}
+
+// Verify - returns subject of valid token or API key
+func (v *Verifier) Verify(credential string, now time.Time) (string, error) {
+	credential = strings.TrimSpace(credential)
+	if credential == "" {
+		return "", ErrUnknown
+	}
+
+	// every key is compared to keep comparison time independent of match
+	subject := ""
+	for _, k := range v.keys {
+		if subtle.ConstantTimeCompare([]byte(credential), k.key) == 1 {
+			subject = k.subject
+		}
+	}
+	if subject != "" {
+		return subject, nil
+	}
+
+	if len(v.secret) == 0 || !strings.Contains(credential, ".") {
+		return "", ErrUnknown
+	}
+	return v.verifyToken(credential, now)
+}
+
+func (v *Verifier) verifyToken(token string, now time.Time) (string, error) {
+	enc, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrMalformed
+	}
+
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return "", ErrMalformed
+	}
+	if !hmac.Equal(got, v.sign(enc)) {
+		return "", ErrSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(enc)
+	if err != nil {
+		return "", ErrMalformed
+	}
+	c := claims{}
+	if err := json.Unmarshal(payload, &c); err != nil || c.Subject == "" || c.Expiry == 0 {
+		return "", ErrMalformed
+	}
+
+	if now.Unix() >= c.Expiry {
+		return "", ErrExpired
+	}
+	return c.Subject, nil
+}
+
+func (v *Verifier) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, v.secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
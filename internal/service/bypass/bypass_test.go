@@ -0,0 +1,178 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package bypass
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef-secret"
+
+func newTestVerifier(t *testing.T, keys ...string) *Verifier {
+	t.Helper()
+
+	v, err := NewVerifier(testSecret, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestIssueVerify(t *testing.T) {
+	v := newTestVerifier(t)
+	now := time.Unix(1700000000, 0)
+
+	token, err := v.Issue("alice", now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject, err := v.Verify(token, now)
+	if err != nil || subject != "alice" {
+		t.Errorf("Verify = %q, %v, want alice", subject, err)
+	}
+	if subject, err := v.Verify("  "+token+"\n", now); err != nil || subject != "alice" {
+		t.Errorf("Verify of padded token = %q, %v, want alice", subject, err)
+	}
+}
+
+func TestVerifyExpired(t *testing.T) {
+	v := newTestVerifier(t)
+	now := time.Unix(1700000000, 0)
+
+	token, err := v.Issue("alice", now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := v.Verify(token, now.Add(time.Minute-time.Second)); err != nil {
+		t.Errorf("Verify before expiry: %v", err)
+	}
+	for _, at := range []time.Time{now.Add(time.Minute), now.Add(time.Hour)} {
+		if _, err := v.Verify(token, at); !errors.Is(err, ErrExpired) {
+			t.Errorf("Verify at %s = %v, want ErrExpired", at.Sub(now), err)
+		}
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	v := newTestVerifier(t)
+	now := time.Unix(1700000000, 0)
+
+	token, err := v.Issue("alice", now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, sig, _ := strings.Cut(token, ".")
+
+	// payload of other subject and later expiry under original signature
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"mallory","exp":4102444800}`))
+
+	other, err := NewVerifier("another-secret-of-16", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign, err := other.Issue("alice", now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flipped := []byte(sig)
+	flipped[0] ^= 'A' ^ 'B'
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"forged payload", forged + "." + sig, ErrSignature},
+		{"flipped signature", payload + "." + string(flipped), ErrSignature},
+		{"truncated signature", payload + "." + sig[:len(sig)-4], ErrSignature},
+		{"signed by other secret", foreign, ErrSignature},
+		{"no signature", payload + ".", ErrSignature},
+		{"bad signature encoding", payload + ".!!!", ErrMalformed},
+		{"extra part", token + ".x", ErrMalformed},
+		{"unsigned json", `{"sub":"alice"}.x`, ErrMalformed},
+		{"no dot", payload, ErrUnknown},
+		{"empty", "", ErrUnknown},
+	}
+
+	for _, tt := range tests {
+		subject, err := v.Verify(tt.token, now)
+		if !errors.Is(err, tt.want) || subject != "" {
+			t.Errorf("%s: Verify = %q, %v, want %v", tt.name, subject, err, tt.want)
+		}
+	}
+}
+
+func TestVerifySignedInvalidClaims(t *testing.T) {
+	v := newTestVerifier(t)
+	now := time.Unix(1700000000, 0)
+
+	for _, payload := range []string{`{"exp":4102444800}`, `{"sub":"alice"}`, `not json`} {
+		enc := base64.RawURLEncoding.EncodeToString([]byte(payload))
+		token := enc + "." + base64.RawURLEncoding.EncodeToString(v.sign(enc))
+		if _, err := v.Verify(token, now); !errors.Is(err, ErrMalformed) {
+			t.Errorf("Verify of %s = %v, want ErrMalformed", payload, err)
+		}
+	}
+}
+
+func TestVerifyKeys(t *testing.T) {
+	v, err := NewVerifier("", []string{"partner:key-one", "key-two"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	tests := []struct {
+		credential string
+		subject    string
+		err        error
+	}{
+		{"key-one", "partner", nil},
+		{"key-two", "api-key-2", nil},
+		{"partner:key-one", "", ErrUnknown},
+		{"key-on", "", ErrUnknown},
+		{"key-one.x", "", ErrUnknown}, // no secret, tokens are not accepted
+	}
+
+	for _, tt := range tests {
+		subject, err := v.Verify(tt.credential, now)
+		if subject != tt.subject || !errors.Is(err, tt.err) {
+			t.Errorf("Verify(%q) = %q, %v, want %q, %v", tt.credential, subject, err, tt.subject, tt.err)
+		}
+	}
+
+	if _, err := v.Issue("alice", now.Add(time.Hour)); err == nil {
+		t.Error("Issue without secret succeeds")
+	}
+}
+
+func TestNewVerifier(t *testing.T) {
+	tests := []struct {
+		secret string
+		keys   []string
+		ok     bool
+	}{
+		{testSecret, nil, true},
+		{"", []string{"k"}, true},
+		{"short", nil, false},
+		{"", nil, false},
+		{"", []string{"subject:"}, false},
+		{testSecret, []string{"  "}, false},
+	}
+
+	for _, tt := range tests {
+		_, err := NewVerifier(tt.secret, tt.keys)
+		if (err == nil) != tt.ok {
+			t.Errorf("NewVerifier(%q, %q) error = %v, want ok %v", tt.secret, tt.keys, err, tt.ok)
+		}
+	}
+}
@@ -6,8 +6,13 @@ package filter
 
 import (
 	"fmt"
+	"log/slog"
 	"net/netip"
-	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/eterline/geo-filt/internal/adapter/logger"
 )
 
 type MatchProvider interface {
@@ -15,30 +20,225 @@ type MatchProvider interface {
 	Match(ip netip.Addr) bool
 }
 
+/*
+CountryProvider - match provider able to resolve country of IP.
+
+	Used to fill Decision.Country of matched IPs.
+*/
+type CountryProvider interface {
+	Country(ip netip.Addr) (string, bool)
+}
+
+// Action - result of filter decision
+type Action uint8
+
+const (
+	ActionDeny Action = iota
+	ActionAllow
+)
+
+func (a Action) String() string {
+	if a == ActionAllow {
+		return "allow"
+	}
+	return "deny"
+}
+
+// ParseAction - parses action name. Empty string means deny.
+func ParseAction(s string) (Action, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "deny", "block":
+		return ActionDeny, nil
+	case "allow", "pass":
+		return ActionAllow, nil
+	}
+	return ActionDeny, fmt.Errorf("unknown filter action: %q", s)
+}
+
+/*
+Tier - precedence group of match providers.
+
+	Rules of lower tier are tested first, so explicitly defined
+	entries beat geo database entries.
+*/
+type Tier uint8
+
+const (
+	TierDefined Tier = iota // defined subnets, IPs and private ranges
+	TierASN                 // autonomous system sets
+	TierGeo                 // geo database sets
+)
+
+func (t Tier) String() string {
+	switch t {
+	case TierDefined:
+		return "defined"
+	case TierASN:
+		return "asn"
+	case TierGeo:
+		return "geo"
+	}
+	return fmt.Sprintf("tier(%d)", uint8(t))
+}
+
+type rule struct {
+	action Action
+	tier   Tier
+	mp     MatchProvider
+}
+
+// before - reports rule precedence: lower tier first, deny before allow inside tier.
+func (r rule) before(o rule) bool {
+	if r.tier != o.tier {
+		return r.tier < o.tier
+	}
+	return r.action == ActionDeny && o.action == ActionAllow
+}
+
+// Decision - filter verdict for IP
+type Decision struct {
+	Action   Action
+	Provider string // matched provider name, empty if default action used
+	Country  string // country ISO code of IP, empty if unknown
+}
+
+// Allowed - reports whether request must be passed
+func (d Decision) Allowed() bool {
+	return d.Action == ActionAllow
+}
+
+// IsDefault - reports whether no provider matched and default action used
+func (d Decision) IsDefault() bool {
+	return d.Provider == ""
+}
+
 type IpFilterService struct {
-	provideQueue []MatchProvider
+	rules         []rule
+	defaultAction Action
+	log           *slog.Logger
+	metrics       *Metrics
+	countries     CountryProvider
 }
 
-func NewIpFilterService() *IpFilterService {
+// NewIpFilterService - creates filter service, metrics are not collected if nil
+func NewIpFilterService(defaultAction Action, log *slog.Logger, metrics *Metrics) *IpFilterService {
 	return &IpFilterService{
-		provideQueue: make([]MatchProvider, 0),
+		rules:         make([]rule, 0),
+		defaultAction: defaultAction,
+		log:           logger.OrDiscard(log),
+		metrics:       metrics,
 	}
 }
 
-// Add - adds MatchProvider object
-func (ifs *IpFilterService) Add(mp MatchProvider) {
-	if mp == nil {
+// Allow - adds MatchProvider object with allow action
+func (ifs *IpFilterService) Allow(tier Tier, mp MatchProvider) {
+	ifs.add(rule{action: ActionAllow, tier: tier, mp: mp})
+}
+
+// Deny - adds MatchProvider object with deny action
+func (ifs *IpFilterService) Deny(tier Tier, mp MatchProvider) {
+	ifs.add(rule{action: ActionDeny, tier: tier, mp: mp})
+}
+
+// Countries - sets country resolver of IPs not located by matched provider
+func (ifs *IpFilterService) Countries(cp CountryProvider) {
+	ifs.countries = cp
+}
+
+func (ifs *IpFilterService) add(r rule) {
+	if r.mp == nil {
 		panic("match provider is nil")
 	}
-	os.Stdout.WriteString(fmt.Sprintf("match provider - added matcher: %s", mp.Provider()))
-	ifs.provideQueue = append(ifs.provideQueue, mp)
+	ifs.log.Info("match provider added",
+		"provider", r.mp.Provider(),
+		"action", r.action.String(),
+		"tier", r.tier.String(),
+	)
+	ifs.rules = append(ifs.rules, r)
+	sort.SliceStable(ifs.rules, func(i, j int) bool {
+		return ifs.rules[i].before(ifs.rules[j])
+	})
 }
 
-func (ifs *IpFilterService) IsAllowed(ip netip.Addr) bool {
-	for _, inst := range ifs.provideQueue {
-		if inst.Match(ip) {
-			return true
+/*
+Decide - tests IP against rules with precedence:
+
+	defined deny > defined allow > asn deny > asn allow >
+	geo deny > geo allow > default action
+*/
+func (ifs *IpFilterService) Decide(ip netip.Addr) Decision {
+	if ifs.metrics == nil {
+		return ifs.decide(ip)
+	}
+
+	start := time.Now()
+	d := ifs.decide(ip)
+	ifs.metrics.observe(ip, d, time.Since(start))
+	return d
+}
+
+func (ifs *IpFilterService) decide(ip netip.Addr) Decision {
+	d := Decision{Action: ifs.defaultAction}
+	for _, r := range ifs.rules {
+		if r.mp.Match(ip) {
+			d = Decision{Action: r.action, Provider: r.mp.Provider()}
+			if cp, ok := r.mp.(CountryProvider); ok {
+				d.Country, _ = cp.Country(ip)
+			}
+			break
 		}
 	}
-	return false
+
+	if d.Country == "" && ifs.countries != nil {
+		d.Country, _ = ifs.countries.Country(ip)
+	}
+	return d
+}
+
+func (ifs *IpFilterService) IsAllowed(ip netip.Addr) bool {
+	return ifs.Decide(ip).Allowed()
+}
+
+// Rule - match provider with its action and tier
+type Rule struct {
+	Provider MatchProvider
+	Action   Action
+	Tier     Tier
+}
+
+// Rules - returns rules in precedence order
+func (ifs *IpFilterService) Rules() []Rule {
+	rules := make([]Rule, 0, len(ifs.rules))
+	for _, r := range ifs.rules {
+		rules = append(rules, Rule{Provider: r.mp, Action: r.action, Tier: r.tier})
+	}
+	return rules
+}
+
+// DefaultAction - returns action of IPs matched by no rule
+func (ifs *IpFilterService) DefaultAction() Action {
+	return ifs.defaultAction
+}
+
+// Trace - result of one rule tested by Explain
+type Trace struct {
+	Rule
+	Matched bool
+}
+
+/*
+Explain - tests IP against every rule in precedence order.
+
+	Returns the same decision as Decide and result of each rule,
+	rules after the deciding one are tested too. Metrics are not collected.
+*/
+func (ifs *IpFilterService) Explain(ip netip.Addr) (Decision, []Trace) {
+	traces := make([]Trace, 0, len(ifs.rules))
+	for _, r := range ifs.rules {
+		traces = append(traces, Trace{
+			Rule:    Rule{Provider: r.mp, Action: r.action, Tier: r.tier},
+			Matched: r.mp.Match(ip),
+		})
+	}
+	return ifs.decide(ip), traces
 }
@@ -5,7 +5,7 @@
 package filter
 
 import (
-	"net"
+	"net/netip"
 )
 
 type IpFilterServiceMock struct{}
@@ -14,6 +14,10 @@ func NewIpFilterServiceMock() (*IpFilterServiceMock, error) {
 	return &IpFilterServiceMock{}, nil
 }
 
-func (ifs *IpFilterServiceMock) IsAllowed(ip net.IP) bool {
+func (ifs *IpFilterServiceMock) Decide(ip netip.Addr) Decision {
+	return Decision{Action: ActionAllow, Provider: "mock"}
+}
+
+func (ifs *IpFilterServiceMock) IsAllowed(ip netip.Addr) bool {
 	return true
 }
@@ -0,0 +1,158 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package filter
+
+import (
+	"net/netip"
+	"testing"
+)
+
+// testProvider - match provider of prefixes
+type testProvider struct {
+	name     string
+	prefixes []netip.Prefix
+}
+
+func newTestProvider(name string, prefixes ...string) *testProvider {
+	p := &testProvider{name: name}
+	for _, s := range prefixes {
+		p.prefixes = append(p.prefixes, netip.MustParsePrefix(s))
+	}
+	return p
+}
+
+func (p *testProvider) Provider() string { return p.name }
+
+func (p *testProvider) Match(ip netip.Addr) bool {
+	for _, pf := range p.prefixes {
+		if pf.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// testGeoProvider - geo match provider resolving country of matched IPs
+type testGeoProvider struct {
+	*testProvider
+	country string
+}
+
+func (p *testGeoProvider) Country(ip netip.Addr) (string, bool) {
+	return p.country, p.Match(ip)
+}
+
+// testCountries - country resolver of every IP
+type testCountries string
+
+func (c testCountries) Country(netip.Addr) (string, bool) { return string(c), true }
+
+// newTestFilter - filter with rule of every tier and action,
+// added out of precedence order
+func newTestFilter(defaultAction Action) *IpFilterService {
+	ifs := NewIpFilterService(defaultAction, nil, nil)
+	ifs.Allow(TierGeo, &testGeoProvider{newTestProvider("geo-allow", "1.0.0.0/8", "4.0.0.0/8"), "US"})
+	ifs.Deny(TierGeo, &testGeoProvider{newTestProvider("geo-deny", "2.0.0.0/8", "3.0.0.0/8"), "RU"})
+	ifs.Allow(TierASN, newTestProvider("asn-allow", "2.1.0.0/16", "5.0.0.0/8"))
+	ifs.Deny(TierASN, newTestProvider("asn-deny", "1.1.0.0/16", "5.5.0.0/16"))
+	ifs.Allow(TierDefined, newTestProvider("defined", "10.0.0.0/8", "3.3.3.3/32", "5.5.5.5/32"))
+	ifs.Deny(TierDefined, newTestProvider("deny-defined", "10.1.0.0/16", "4.4.4.4/32"))
+	return ifs
+}
+
+func TestDecidePrecedence(t *testing.T) {
+	ifs := newTestFilter(ActionDeny)
+
+	tests := []struct {
+		name     string
+		ip       string
+		action   Action
+		provider string
+		country  string
+		tier     Tier
+	}{
+		{"defined deny over defined allow", "10.1.2.3", ActionDeny, "deny-defined", "", TierDefined},
+		{"defined allow", "10.2.0.1", ActionAllow, "defined", "", TierDefined},
+		{"defined allow over geo deny", "3.3.3.3", ActionAllow, "defined", "", TierDefined},
+		{"defined allow over asn deny", "5.5.5.5", ActionAllow, "defined", "", TierDefined},
+		{"defined deny over geo allow", "4.4.4.4", ActionDeny, "deny-defined", "", TierDefined},
+		{"asn allow over geo deny", "2.1.0.1", ActionAllow, "asn-allow", "", TierASN},
+		{"geo allow under asn deny", "1.1.0.1", ActionDeny, "asn-deny", "", TierASN},
+		{"asn deny over asn allow", "5.5.0.1", ActionDeny, "asn-deny", "", TierASN},
+		{"asn allow", "5.0.0.1", ActionAllow, "asn-allow", "", TierASN},
+		{"geo deny", "2.2.0.1", ActionDeny, "geo-deny", "RU", TierGeo},
+		{"geo allow", "1.2.0.1", ActionAllow, "geo-allow", "US", TierGeo},
+	}
+
+	for _, tt := range tests {
+		ip := netip.MustParseAddr(tt.ip)
+		d := ifs.Decide(ip)
+		if d.Action != tt.action || d.Provider != tt.provider || d.Country != tt.country || d.IsDefault() {
+			t.Errorf("%s: Decide(%s) = %+v, want %s by %s", tt.name, ip, d, tt.action, tt.provider)
+		}
+
+		ed, traces := ifs.Explain(ip)
+		if ed != d {
+			t.Errorf("%s: Explain(%s) = %+v, Decide = %+v", tt.name, ip, ed, d)
+		}
+		for _, tr := range traces {
+			if tr.Matched {
+				if tr.Provider.Provider() != tt.provider || tr.Tier != tt.tier || tr.Action != tt.action {
+					t.Errorf("%s: first matched rule is %s %s %s, want %s %s %s", tt.name,
+						tr.Provider.Provider(), tr.Tier, tr.Action, tt.provider, tt.tier, tt.action)
+				}
+				break
+			}
+		}
+	}
+}
+
+func TestDecideDefault(t *testing.T) {
+	ip := netip.MustParseAddr("9.9.9.9")
+
+	for _, action := range []Action{ActionDeny, ActionAllow} {
+		ifs := newTestFilter(action)
+		d := ifs.Decide(ip)
+		if d.Action != action || !d.IsDefault() || d.Country != "" {
+			t.Errorf("Decide with default %s = %+v", action, d)
+		}
+
+		// country of unmatched IP is resolved by filter countries
+		ifs.Countries(testCountries("NL"))
+		if d := ifs.Decide(ip); d.Action != action || !d.IsDefault() || d.Country != "NL" {
+			t.Errorf("Decide with default %s and countries = %+v", action, d)
+		}
+		if d := ifs.Decide(netip.MustParseAddr("1.2.0.1")); d.Country != "US" {
+			t.Errorf("Decide of geo matched IP country = %q, want US", d.Country)
+		}
+
+		ed, traces := ifs.Explain(ip)
+		if ed.Action != action || !ed.IsDefault() || len(traces) != 6 {
+			t.Errorf("Explain with default %s = %+v, %d traces", action, ed, len(traces))
+		}
+		for _, tr := range traces {
+			if tr.Matched {
+				t.Errorf("Explain: rule %s matches %s", tr.Provider.Provider(), ip)
+			}
+		}
+	}
+}
+
+func TestRulesOrder(t *testing.T) {
+	want := []string{"deny-defined", "defined", "asn-deny", "asn-allow", "geo-deny", "geo-allow"}
+
+	rules := newTestFilter(ActionDeny).Rules()
+	if len(rules) != len(want) {
+		t.Fatalf("Rules has %d rules, want %d", len(rules), len(want))
+	}
+	for i, r := range rules {
+		if r.Provider.Provider() != want[i] {
+			t.Errorf("rule %d = %s, want %s", i, r.Provider.Provider(), want[i])
+		}
+		if i > 0 && rules[i-1].Tier > r.Tier {
+			t.Errorf("rule %d tier %s is before tier %s", i, rules[i-1].Tier, r.Tier)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package filter
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/eterline/geo-filt/internal/adapter/metrics"
+)
+
+// Metrics - filter decisions metrics in Prometheus text exposition format
+type Metrics struct {
+	*metrics.Registry
+	decisions *metrics.CounterVec
+	latency   *metrics.Histogram
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		Registry: metrics.NewRegistry(),
+		decisions: metrics.NewCounterVec(
+			"geofilt_decisions_total",
+			"Filter decisions by action, match provider, country code and IP family.",
+			"action", "provider", "country", "family",
+		),
+		latency: metrics.NewHistogram(
+			"geofilt_lookup_duration_seconds",
+			"Filter decision lookup latency.",
+			[]float64{1e-6, 2.5e-6, 5e-6, 1e-5, 2.5e-5, 5e-5, 1e-4, 2.5e-4, 1e-3, 1e-2},
+		),
+	}
+	m.Register(m.decisions, m.latency)
+	return m
+}
+
+func (m *Metrics) observe(ip netip.Addr, d Decision, took time.Duration) {
+	provider := d.Provider
+	if d.IsDefault() {
+		provider = "default"
+	}
+
+	family := "ipv6"
+	if ip.Is4() || ip.Is4In6() {
+		family = "ipv4"
+	}
+
+	m.decisions.Inc(d.Action.String(), provider, d.Country, family)
+	m.latency.Observe(took.Seconds())
+}
@@ -5,43 +5,101 @@
 package ipscraper
 
 import (
+	"log/slog"
 	"net"
 	"net/http"
 	"net/netip"
 	"strings"
+
+	"github.com/eterline/geo-filt/internal/adapter/logger"
+	"github.com/eterline/geo-filt/pkg/netipuse"
+)
+
+// IP sources of extraction result
+const (
+	SourceRemoteAddr    = "RemoteAddr"
+	SourceXRealIP       = "X-Real-IP"
+	SourceXForwardedFor = "X-Forwarded-For"
+	SourceForwarded     = "Forwarded"
 )
 
 type IpExtractor struct {
 	headers bool
+	trusted *netipuse.PoolIP
+	log     *slog.Logger
 }
 
-func NewIpExtractor(headers bool) *IpExtractor {
+/*
+NewIpExtractor - creates IP extractor.
+
+	Headers are honored only from trusted RemoteAddr and chains
+	are walked right-to-left skipping trusted hops. If trusted is nil,
+	no client is trusted and RemoteAddr is always used.
+*/
+func NewIpExtractor(headers bool, trusted *netipuse.PoolIP, log *slog.Logger) *IpExtractor {
 	return &IpExtractor{
 		headers: headers,
+		trusted: trusted,
+		log:     logger.OrDiscard(log),
 	}
 }
 
 // ExtractIP - parses IP from client or request headers
 func (is *IpExtractor) ExtractIP(r *http.Request) (netip.Addr, bool) {
+	ip, _, ok := is.ExtractIPSource(r)
+	return ip, ok
+}
+
+// ExtractIPSource - parses IP from client or request headers, returns IP source header name or RemoteAddr
+func (is *IpExtractor) ExtractIPSource(r *http.Request) (netip.Addr, string, bool) {
+	ip, ok := remote(r)
 	if is.headers {
-		if ip, ok := headers(r); ok {
-			return ip, true
+		if ok && is.trusted != nil && is.trusted.Contains(ip) {
+			if hip, source, hok := is.fromHeaders(r.Header); hok {
+				return hip, source, true
+			}
+		} else if hasHeaders(r.Header) {
+			is.log.Debug("client ip headers ignored from untrusted remote", "remote", r.RemoteAddr)
 		}
 	}
-	return remote(r)
+	return ip, SourceRemoteAddr, ok
 }
 
-func headers(r *http.Request) (netip.Addr, bool) {
-	if ip, ok := parseXRealIP(r.Header); ok {
-		return ip, false
+/*
+fromHeaders - parses client IP of request from trusted remote.
+
+	Chains are walked first: proxies append hops to them,
+	while X-Real-IP may be passed from client unchanged,
+	so it is used only if request has no chain.
+*/
+func (is *IpExtractor) fromHeaders(h http.Header) (netip.Addr, string, bool) {
+	if chain := parseXForwardedFor(h); len(chain) > 0 {
+		return is.pick(chain), SourceXForwardedFor, true
 	}
-	if ip, ok := parseXForwardedFor(r.Header); ok {
-		return ip, false
+	if chain := parseForwarded(h); len(chain) > 0 {
+		return is.pick(chain), SourceForwarded, true
 	}
-	if ip, ok := parseForwarded(r.Header); ok {
-		return ip, false
+	if ip, ok := parseXRealIP(h); ok {
+		return ip, SourceXRealIP, true
 	}
-	return netip.Addr{}, false
+	return netip.Addr{}, "", false
+}
+
+func hasHeaders(h http.Header) bool {
+	return h.Get(SourceXRealIP) != "" ||
+		h.Get(SourceXForwardedFor) != "" ||
+		h.Get(SourceForwarded) != ""
+}
+
+// pick - selects client address from proxy chain
+func (is *IpExtractor) pick(chain []netip.Addr) netip.Addr {
+	for i := len(chain) - 1; i >= 0; i-- {
+		if !is.trusted.Contains(chain[i]) {
+			return chain[i]
+		}
+	}
+	// every hop is trusted, the origin is the leftmost one
+	return chain[0]
 }
 
 func remote(r *http.Request) (netip.Addr, bool) {
@@ -55,65 +113,69 @@ func remote(r *http.Request) (netip.Addr, bool) {
 		return netip.Addr{}, false
 	}
 
-	return ip, true
+	return ip.Unmap(), true
 }
 
-// parseXForwardedFor - parses 'X-Real-IP' Nginx reverse proxy header
-func parseXRealIP(h http.Header) (netip.Addr, bool) {
-	bearer := h.Get("X-Real-IP")
-	if bearer == "" {
-		return netip.Addr{}, false
+// parseHost - parses address with optional port and brackets
+func parseHost(s string) (netip.Addr, bool) {
+	s = strings.Trim(strings.TrimSpace(s), "\"")
+	if ap, err := netip.ParseAddrPort(s); err == nil {
+		return ap.Addr().Unmap(), true
 	}
-
-	ipStr := strings.TrimSpace(bearer)
-	ip, err := netip.ParseAddr(ipStr)
-	if err == nil {
+	ip, err := netip.ParseAddr(strings.Trim(s, "[]"))
+	if err != nil {
 		return netip.Addr{}, false
 	}
-	return ip, true
+	return ip.Unmap(), true
 }
 
-// parseXForwardedFor - parses 'X-Forwarded-For' header
-func parseXForwardedFor(h http.Header) (netip.Addr, bool) {
-	bearer := h.Get("X-Forwarded-For")
+// parseXRealIP - parses 'X-Real-IP' Nginx reverse proxy header
+func parseXRealIP(h http.Header) (netip.Addr, bool) {
+	bearer := h.Get(SourceXRealIP)
 	if bearer == "" {
 		return netip.Addr{}, false
 	}
+	return parseHost(bearer)
+}
 
-	parts := strings.Split(bearer, ",")
-	if len(parts) == 0 {
-		return netip.Addr{}, false
-	}
-
-	ipStr := strings.TrimSpace(parts[0])
-	ip, err := netip.ParseAddr(ipStr)
-	if err == nil {
-		return ip, false
+// parseXForwardedFor - parses 'X-Forwarded-For' header chain.
+// Chain is cut on first invalid entry from the right side.
+func parseXForwardedFor(h http.Header) []netip.Addr {
+	var parts []string
+	for _, v := range h.Values(SourceXForwardedFor) {
+		parts = append(parts, strings.Split(v, ",")...)
 	}
-	return netip.Addr{}, true
+	return chainOf(parts, func(s string) string { return s })
 }
 
-// parseForwarded - parses 'Forwarded' RFC 7239 header
-func parseForwarded(h http.Header) (netip.Addr, bool) {
-	bearer := h.Get("Forwarded")
-	if bearer == "" {
-		return netip.Addr{}, false
+// parseForwarded - parses 'Forwarded' RFC 7239 header chain
+func parseForwarded(h http.Header) []netip.Addr {
+	var parts []string
+	for _, v := range h.Values(SourceForwarded) {
+		parts = append(parts, strings.Split(v, ",")...)
 	}
-
-	entries := strings.Split(bearer, ",")
-	for _, entry := range entries {
-		parts := strings.Split(entry, ";")
-		for _, p := range parts {
+	return chainOf(parts, func(entry string) string {
+		for _, p := range strings.Split(entry, ";") {
 			p = strings.TrimSpace(p)
 			if strings.HasPrefix(strings.ToLower(p), "for=") {
-				val := strings.TrimPrefix(p, "for=")
-				val = strings.Trim(val, "\"[]")
-				ip, err := netip.ParseAddr(val)
-				if err == nil {
-					return ip, false
-				}
+				return p[len("for="):]
 			}
 		}
+		return ""
+	})
+}
+
+// chainOf - parses hop addresses keeping the valid right side of chain
+func chainOf(parts []string, hop func(string) string) []netip.Addr {
+	chain := make([]netip.Addr, len(parts))
+	start := len(parts)
+	for i := len(parts) - 1; i >= 0; i-- {
+		ip, ok := parseHost(hop(parts[i]))
+		if !ok {
+			break
+		}
+		chain[i] = ip
+		start = i
 	}
-	return netip.Addr{}, false
+	return chain[start:]
 }
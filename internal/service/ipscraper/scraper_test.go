@@ -0,0 +1,158 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package ipscraper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/eterline/geo-filt/pkg/netipuse"
+)
+
+func trustedPool(t *testing.T, subnets ...string) *netipuse.PoolIP {
+	t.Helper()
+
+	b := &netipuse.PoolIPBuilder{}
+	for _, s := range subnets {
+		b.AddPrefix(netip.MustParsePrefix(s))
+	}
+	pool, err := b.PoolIP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+func TestExtractIPSource(t *testing.T) {
+	trusted := trustedPool(t, "10.0.0.0/8", "2001:db8:ffff::/48")
+
+	tests := []struct {
+		name    string
+		trusted *netipuse.PoolIP
+		headers bool
+		remote  string
+		header  map[string]string
+		ip      string
+		source  string
+	}{
+		{
+			name:    "headers disabled",
+			trusted: trusted,
+			remote:  "10.0.0.1:1234",
+			header:  map[string]string{"X-Forwarded-For": "1.1.1.1"},
+			ip:      "10.0.0.1",
+			source:  SourceRemoteAddr,
+		},
+		{
+			name:    "untrusted remote spoofs x-real-ip",
+			trusted: trusted,
+			headers: true,
+			remote:  "5.5.5.5:1234",
+			header:  map[string]string{"X-Real-IP": "6.6.6.6"},
+			ip:      "5.5.5.5",
+			source:  SourceRemoteAddr,
+		},
+		{
+			name:    "untrusted remote spoofs chain",
+			trusted: trusted,
+			headers: true,
+			remote:  "5.5.5.5:1234",
+			header:  map[string]string{"X-Forwarded-For": "6.6.6.6", "Forwarded": "for=6.6.6.6"},
+			ip:      "5.5.5.5",
+			source:  SourceRemoteAddr,
+		},
+		{
+			name:    "trusted remote passes spoofed x-real-ip",
+			trusted: trusted,
+			headers: true,
+			remote:  "10.0.0.1:1234",
+			header:  map[string]string{"X-Real-IP": "6.6.6.6", "X-Forwarded-For": "2.2.2.2"},
+			ip:      "2.2.2.2",
+			source:  SourceXForwardedFor,
+		},
+		{
+			name:    "trusted remote passes spoofed chain head",
+			trusted: trusted,
+			headers: true,
+			remote:  "10.0.0.1:1234",
+			header:  map[string]string{"X-Forwarded-For": "6.6.6.6, 2.2.2.2, 10.0.0.5"},
+			ip:      "2.2.2.2",
+			source:  SourceXForwardedFor,
+		},
+		{
+			name:    "trusted remote forwarded chain",
+			trusted: trusted,
+			headers: true,
+			remote:  "[2001:db8:ffff::1]:443",
+			header:  map[string]string{"X-Real-IP": "6.6.6.6", "Forwarded": `for=6.6.6.6, for="[2001:db8::1]:443";proto=https`},
+			ip:      "2001:db8::1",
+			source:  SourceForwarded,
+		},
+		{
+			name:    "trusted remote without chain",
+			trusted: trusted,
+			headers: true,
+			remote:  "10.0.0.1:1234",
+			header:  map[string]string{"X-Real-IP": "3.3.3.3"},
+			ip:      "3.3.3.3",
+			source:  SourceXRealIP,
+		},
+		{
+			name:    "every hop trusted",
+			trusted: trusted,
+			headers: true,
+			remote:  "10.0.0.1:1234",
+			header:  map[string]string{"X-Forwarded-For": "10.0.0.7, 10.0.0.5"},
+			ip:      "10.0.0.7",
+			source:  SourceXForwardedFor,
+		},
+		{
+			name:    "invalid hop cuts chain",
+			trusted: trusted,
+			headers: true,
+			remote:  "10.0.0.1:1234",
+			header:  map[string]string{"X-Forwarded-For": "2.2.2.2, garbage, 10.0.0.5"},
+			ip:      "10.0.0.5",
+			source:  SourceXForwardedFor,
+		},
+		{
+			name:    "no trusted proxies",
+			headers: true,
+			remote:  "5.5.5.5:1234",
+			header:  map[string]string{"X-Real-IP": "3.3.3.3", "X-Forwarded-For": "1.1.1.1, 2.2.2.2"},
+			ip:      "5.5.5.5",
+			source:  SourceRemoteAddr,
+		},
+		{
+			name:    "every client trusted",
+			trusted: trustedPool(t, "0.0.0.0/0", "::/0"),
+			headers: true,
+			remote:  "5.5.5.5:1234",
+			header:  map[string]string{"X-Real-IP": "3.3.3.3", "X-Forwarded-For": "1.1.1.1, 2.2.2.2"},
+			ip:      "1.1.1.1",
+			source:  SourceXForwardedFor,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			for key, value := range tt.header {
+				req.Header.Set(key, value)
+			}
+
+			ip, source, ok := NewIpExtractor(tt.headers, tt.trusted, nil).ExtractIPSource(req)
+			if !ok {
+				t.Fatal("no IP extracted")
+			}
+			if ip != netip.MustParseAddr(tt.ip) || source != tt.source {
+				t.Errorf("ExtractIPSource = %s from %s, want %s from %s", ip, source, tt.ip, tt.source)
+			}
+		})
+	}
+}
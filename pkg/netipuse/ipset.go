@@ -24,6 +24,9 @@ import (
 // Most PoolIPBuilder methods do not return errors.
 // Instead, errors are accumulated and reported by PoolIPBuilder.PoolIP.
 type PoolIPBuilder struct {
+	// Layout is the lookup layout of built PoolIPs.
+	Layout LookupLayout
+
 	// in are the ranges in the set.
 	in []PoolRange
 
@@ -164,8 +167,9 @@ func (s *PoolIPBuilder) normalize() {
 // Clone returns a copy of s that shares no memory with s.
 func (s *PoolIPBuilder) Clone() *PoolIPBuilder {
 	return &PoolIPBuilder{
-		in:  append([]PoolRange(nil), s.in...),
-		out: append([]PoolRange(nil), s.out...),
+		Layout: s.Layout,
+		in:     append([]PoolRange(nil), s.in...),
+		out:    append([]PoolRange(nil), s.out...),
 	}
 }
 
@@ -307,9 +311,9 @@ var debugf = discardf
 // Calling PoolIP clears any accumulated errors.
 func (s *PoolIPBuilder) PoolIP() (*PoolIP, error) {
 	s.normalize()
-	ret := &PoolIP{
+	ret := (&PoolIP{
 		rr: append([]PoolRange{}, s.in...),
-	}
+	}).WithLayout(s.Layout)
 	if len(s.errs) == 0 {
 		return ret, nil
 	} else {
@@ -331,6 +335,30 @@ type PoolIP struct {
 	// ranges, no contiguous ranges). The implementation of various
 	// methods rely on this property.
 	rr []PoolRange
+
+	// flat are bounds of rr for LayoutFlat lookups, nil for LayoutRanges.
+	flat *flatRanges
+}
+
+// PoolIPFromRanges returns a PoolIP of rr without copying it.
+//
+// The ranges must already be normalized, as returned by PoolIP.Ranges:
+// valid, sorted, not overlapping and not contiguous. Otherwise
+// PoolIPFromRanges returns an error. rr must not be modified afterwards.
+func PoolIPFromRanges(rr []PoolRange) (*PoolIP, error) {
+	for i, r := range rr {
+		if !r.IsValid() {
+			return nil, fmt.Errorf("invalid range %d: %s", i, r)
+		}
+		if i == 0 {
+			continue
+		}
+		prev := rr[i-1]
+		if !prev.to.Less(r.from) || prev.to.Next() == r.from {
+			return nil, fmt.Errorf("range %d %s is not normalized after %s", i, r, prev)
+		}
+	}
+	return &PoolIP{rr: rr}, nil
 }
 
 // Ranges returns the minimum and sorted set of IP
@@ -367,29 +395,43 @@ func (s *PoolIP) Equal(o *PoolIP) bool {
 // If ip has an IPv6 zone, Contains returns false,
 // because PoolIPs do not track zones.
 func (s *PoolIP) Contains(ip netip.Addr) bool {
+	_, ok := s.RangeOf(ip)
+	return ok
+}
+
+// RangeOf returns the range of s that contains ip.
+// If ip is not in s or has an IPv6 zone, RangeOf returns ok=false.
+func (s *PoolIP) RangeOf(ip netip.Addr) (r PoolRange, ok bool) {
 	if ip.Zone() != "" {
-		return false
+		return PoolRange{}, false
+	}
+	if s.flat != nil {
+		i, ok := s.flat.search(ip)
+		if !ok {
+			return PoolRange{}, false
+		}
+		return s.rr[i], true
 	}
-	// TODO: data structure permitting more efficient lookups:
-	// https://github.com/inetaf/netaddr/issues/139
 	i := sort.Search(len(s.rr), func(i int) bool {
 		return ip.Less(s.rr[i].from)
 	})
 	if i == 0 {
-		return false
+		return PoolRange{}, false
 	}
 	i--
-	return s.rr[i].contains(ip)
+	if !s.rr[i].contains(ip) {
+		return PoolRange{}, false
+	}
+	return s.rr[i], true
 }
 
 // ContainsRange reports whether all IPs in r are in s.
 func (s *PoolIP) ContainsRange(r PoolRange) bool {
-	for _, x := range s.rr {
-		if r.coveredBy(x) {
-			return true
-		}
+	if !r.IsValid() {
+		return false
 	}
-	return false
+	x, ok := s.RangeOf(r.from)
+	return ok && r.coveredBy(x)
 }
 
 // ContainsPrefix reports whether all IPs in p are in s.
@@ -398,27 +440,32 @@ func (s *PoolIP) ContainsPrefix(p netip.Prefix) bool {
 }
 
 // Overlaps reports whether any IP in b is also in s.
+// It walks both sorted range lists once, in O(n+m).
 func (s *PoolIP) Overlaps(b *PoolIP) bool {
-	// TODO: sorted ranges lets us do this in O(n+m)
-	for _, r := range s.rr {
-		for _, or := range b.rr {
-			if r.Overlaps(or) {
-				return true
-			}
+	i, j := 0, 0
+	for i < len(s.rr) && j < len(b.rr) {
+		if s.rr[i].Overlaps(b.rr[j]) {
+			return true
+		}
+		if s.rr[i].to.Less(b.rr[j].to) {
+			i++
+		} else {
+			j++
 		}
 	}
 	return false
 }
 
 // OverlapsRange reports whether any IP in r is also in s.
+// It searches the first range of s not ending before r, in O(log n).
 func (s *PoolIP) OverlapsRange(r PoolRange) bool {
-	// TODO: sorted ranges lets us do this more efficiently.
-	for _, x := range s.rr {
-		if x.Overlaps(r) {
-			return true
-		}
+	if !r.IsValid() {
+		return false
 	}
-	return false
+	i := sort.Search(len(s.rr), func(i int) bool {
+		return !s.rr[i].to.Less(r.from)
+	})
+	return i < len(s.rr) && s.rr[i].Overlaps(r)
 }
 
 // OverlapsPrefix reports whether any IP in p is also in s.
@@ -0,0 +1,133 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+// Package netipuse implements IP sets, set operations and range maps
+// used by the plugin matchers.
+//
+// Matchers always search sets with LayoutRanges. LayoutFlat is
+// library-only: it is not exposed by the plugin configuration and
+// is selected by callers with PoolIP.WithLayout.
+package netipuse
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"sort"
+)
+
+// LookupLayout selects the data structure searched by PoolIP.Contains
+// and PoolIP.RangeOf.
+type LookupLayout uint8
+
+const (
+	// LayoutRanges searches the sorted PoolRange slice of the set,
+	// comparing 128-bit netip.Addr values for both families.
+	LayoutRanges LookupLayout = iota
+	// LayoutFlat searches separate arrays of range bounds:
+	// uint32 for IPv4 and uint128 for IPv6. It costs 8 bytes per
+	// IPv4 range and 32 bytes per IPv6 range on top of the ranges.
+	// Compare both layouts with BenchmarkLookup and BenchmarkLayout.
+	LayoutFlat
+)
+
+func (l LookupLayout) String() string {
+	switch l {
+	case LayoutRanges:
+		return "ranges"
+	case LayoutFlat:
+		return "flat"
+	}
+	return "unknown"
+}
+
+// flatRanges holds bounds of normalized ranges as integers.
+// IPv4 ranges precede IPv6 ranges in PoolIP.rr, so IPv6 bounds
+// are offset by len(from4).
+type flatRanges struct {
+	from4, to4 []uint32
+	from6, to6 []uint128
+}
+
+func newFlatRanges(rr []PoolRange) *flatRanges {
+	n4 := sort.Search(len(rr), func(i int) bool {
+		return !rr[i].from.Is4()
+	})
+	f := &flatRanges{
+		from4: make([]uint32, 0, n4),
+		to4:   make([]uint32, 0, n4),
+		from6: make([]uint128, 0, len(rr)-n4),
+		to6:   make([]uint128, 0, len(rr)-n4),
+	}
+	for _, r := range rr {
+		if r.from.Is4() {
+			f.from4 = append(f.from4, u32From4(r.from))
+			f.to4 = append(f.to4, u32From4(r.to))
+			continue
+		}
+		f.from6 = append(f.from6, u128From16(r.from.As16()))
+		f.to6 = append(f.to6, u128From16(r.to.As16()))
+	}
+	return f
+}
+
+func u32From4(ip netip.Addr) uint32 {
+	a := ip.As4()
+	return binary.BigEndian.Uint32(a[:])
+}
+
+// search returns index of the range containing ip.
+func (f *flatRanges) search(ip netip.Addr) (int, bool) {
+	if ip.Is4() {
+		x := u32From4(ip)
+		lo, hi := 0, len(f.from4)
+		for lo < hi {
+			mid := int(uint(lo+hi) >> 1)
+			if x < f.from4[mid] {
+				hi = mid
+			} else {
+				lo = mid + 1
+			}
+		}
+		if lo == 0 || x > f.to4[lo-1] {
+			return 0, false
+		}
+		return lo - 1, true
+	}
+
+	x := u128From16(ip.As16())
+	lo, hi := 0, len(f.from6)
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if x.cmp(f.from6[mid]) < 0 {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	if lo == 0 || x.cmp(f.to6[lo-1]) > 0 {
+		return 0, false
+	}
+	return len(f.from4) + lo - 1, true
+}
+
+// Layout returns the lookup layout of s.
+func (s *PoolIP) Layout() LookupLayout {
+	if s.flat != nil {
+		return LayoutFlat
+	}
+	return LayoutRanges
+}
+
+// WithLayout returns a PoolIP of the same IPs as s searched with layout l.
+// The ranges are shared with s.
+func (s *PoolIP) WithLayout(l LookupLayout) *PoolIP {
+	if s.Layout() == l {
+		return s
+	}
+	ret := &PoolIP{rr: s.rr}
+	if l == LayoutFlat {
+		ret.flat = newFlatRanges(s.rr)
+	}
+	return ret
+}
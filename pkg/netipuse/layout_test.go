@@ -0,0 +1,170 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package netipuse
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"net/netip"
+	"testing"
+)
+
+// Sizes of GeoLite2-Country networks, the largest country DB
+// the plugin loads.
+const (
+	benchRanges4 = 400000
+	benchRanges6 = 500000
+)
+
+// benchPool returns a set of n4 IPv4 and n6 IPv6 disjoint ranges
+// spread over the address space like networks of a country DB.
+func benchPool(b *testing.B, n4, n6 int) *PoolIP {
+	b.Helper()
+
+	rnd := rand.New(rand.NewSource(1))
+	var pb PoolIPBuilder
+
+	step4 := uint32(1<<32/uint64(n4+1)) &^ 0xff
+	for i := 0; i < n4; i++ {
+		var a [4]byte
+		binary.BigEndian.PutUint32(a[:], uint32(i+1)*step4)
+		pb.AddPrefix(netip.PrefixFrom(netip.AddrFrom4(a), 24-rnd.Intn(4)))
+	}
+	for i := 0; i < n6; i++ {
+		var a [16]byte
+		a[0] = 0x20
+		binary.BigEndian.PutUint32(a[1:5], uint32(i+1)*4096)
+		pb.AddPrefix(netip.PrefixFrom(netip.AddrFrom16(a), 48-rnd.Intn(8)))
+	}
+
+	s, err := pb.PoolIP()
+	if err != nil {
+		b.Fatal(err)
+	}
+	return s
+}
+
+// benchAddrs returns IPs to look up, about half of them are in s.
+func benchAddrs(s *PoolIP, is4 bool) []netip.Addr {
+	rnd := rand.New(rand.NewSource(2))
+	ips := make([]netip.Addr, 0, 4096)
+	for len(ips) < cap(ips) {
+		r := s.rr[rnd.Intn(len(s.rr))]
+		if r.from.Is4() != is4 {
+			continue
+		}
+		ip := r.from
+		if rnd.Intn(2) == 0 {
+			ip = r.to.Next()
+		}
+		if ip.IsValid() {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+// benchFound keeps lookups from being optimized away.
+var benchFound bool
+
+func BenchmarkLookup(b *testing.B) {
+	s := benchPool(b, benchRanges4, benchRanges6)
+
+	families := []struct {
+		name string
+		is4  bool
+	}{
+		{"ipv4", true},
+		{"ipv6", false},
+	}
+	layouts := []LookupLayout{LayoutRanges, LayoutFlat}
+
+	for _, fam := range families {
+		ips := benchAddrs(s, fam.is4)
+		for _, l := range layouts {
+			ls := s.WithLayout(l)
+			b.Run(fam.name+"/"+l.String(), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					benchFound = ls.Contains(ips[i%len(ips)])
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkLayout reports memory of lookup structure built on top
+// of the ranges, LayoutRanges builds none.
+func BenchmarkLayout(b *testing.B) {
+	s := benchPool(b, benchRanges4, benchRanges6)
+
+	for _, l := range []LookupLayout{LayoutRanges, LayoutFlat} {
+		b.Run(l.String(), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				s.WithLayout(l)
+			}
+			b.ReportMetric(float64(len(s.rr)), "ranges")
+		})
+	}
+}
+
+// TestLayoutFlatMatchesRanges compares lookups of both layouts on
+// random sets, at range edges and at ends of address spaces.
+func TestLayoutFlatMatchesRanges(t *testing.T) {
+	bases := []struct {
+		name string
+		base []netip.Addr
+	}{
+		{"ipv4", []netip.Addr{netip.MustParseAddr("0.0.0.0"), netip.MustParseAddr("10.0.0.0")}},
+		{"ipv4-end", []netip.Addr{netip.MustParseAddr("255.255.254.224")}},
+		{"ipv6", []netip.Addr{netip.MustParseAddr("::"), netip.MustParseAddr("2001:db8::")}},
+		{"ipv6-end", []netip.Addr{netip.MustParseAddr("ffff:ffff:ffff:ffff:ffff:ffff:ffff:fee0")}},
+		{"mixed", []netip.Addr{netip.MustParseAddr("255.255.254.224"), netip.MustParseAddr("::"), netip.MustParseAddr("::ffff:10.0.0.0")}},
+	}
+	extremes := []netip.Addr{
+		netip.MustParseAddr("0.0.0.0"),
+		netip.MustParseAddr("255.255.255.255"),
+		netip.MustParseAddr("::"),
+		netip.MustParseAddr("::ffff:255.255.255.255"),
+		netip.MustParseAddr("ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"),
+		netip.MustParseAddr("fe80::1%eth0"),
+	}
+
+	for _, tt := range bases {
+		t.Run(tt.name, func(t *testing.T) {
+			rnd := rand.New(rand.NewSource(3))
+			for i := 0; i < 500; i++ {
+				s := &PoolIP{}
+				for _, base := range tt.base {
+					s = s.Union(randomPool(t, rnd, base))
+				}
+				flat := s.WithLayout(LayoutFlat)
+
+				ips := append([]netip.Addr{}, extremes...)
+				for _, r := range s.Ranges() {
+					ips = append(ips, r.From(), r.To(), r.From().Prev(), r.To().Next())
+				}
+				for n := 0; n < 32; n++ {
+					ips = append(ips, addrAdd(tt.base[rnd.Intn(len(tt.base))], rnd.Intn(300)))
+				}
+
+				for _, ip := range ips {
+					if !ip.IsValid() {
+						continue
+					}
+					want, wantOK := s.RangeOf(ip)
+					got, ok := flat.RangeOf(ip)
+					if ok != wantOK || got != want {
+						t.Fatalf("set %v: flat RangeOf(%s) = %s, %v, want %s, %v", s.Ranges(), ip, got, ok, want, wantOK)
+					}
+					if flat.Contains(ip) != s.Contains(ip) {
+						t.Fatalf("set %v: flat Contains(%s) = %v", s.Ranges(), ip, flat.Contains(ip))
+					}
+				}
+			}
+		})
+	}
+}
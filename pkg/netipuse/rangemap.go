@@ -0,0 +1,264 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package netipuse
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+)
+
+// OverlapPolicy selects the value of IPs covered by several ranges
+// added to a RangeMapBuilder.
+type OverlapPolicy uint8
+
+const (
+	// LastWins assigns the value of the range added last.
+	LastWins OverlapPolicy = iota
+	// MostSpecificWins assigns the value of the smallest range.
+	// Ranges of the same size are resolved as LastWins.
+	MostSpecificWins
+)
+
+// RangeMapBuilder builds an immutable RangeMap.
+//
+// The zero value is a valid empty builder with LastWins policy.
+// Like PoolIPBuilder, it ignores invalid inputs and reports
+// them from RangeMap.
+type RangeMapBuilder struct {
+	// Policy resolves values of overlapping ranges.
+	Policy OverlapPolicy
+	// Resolve, if set, assigns the value of every segment of IPs
+	// covered by the same ranges. It is called with values of all
+	// these ranges ordered by Policy, the winning value first.
+	Resolve func(vs []int) int
+
+	in   []rangeMapEntry
+	errs multiErr
+}
+
+type rangeMapEntry struct {
+	r   PoolRange
+	v   int
+	seq int
+}
+
+// Add maps ip to v.
+func (b *RangeMapBuilder) Add(ip netip.Addr, v int) {
+	b.AddRange(PoolRangeFrom(ip, ip), v)
+}
+
+// AddPrefix maps all IPs in p to v.
+func (b *RangeMapBuilder) AddPrefix(p netip.Prefix, v int) {
+	if r := RangeOfPrefix(p); r.IsValid() {
+		b.AddRange(r, v)
+	} else {
+		b.errs = append(b.errs, fmt.Errorf("AddPrefix(%v/%v)", p.Addr(), p.Bits()))
+	}
+}
+
+// AddRange maps all IPs in r to v.
+// If r is not valid, AddRange does nothing.
+func (b *RangeMapBuilder) AddRange(r PoolRange, v int) {
+	if !r.IsValid() {
+		b.errs = append(b.errs, fmt.Errorf("AddRange(%v-%v)", r.From(), r.To()))
+		return
+	}
+	b.in = append(b.in, rangeMapEntry{r: r, v: v, seq: len(b.in)})
+}
+
+// RangeMap returns an immutable RangeMap representing the current
+// state of b. Overlaps are resolved by b.Policy and adjacent ranges
+// with equal values are merged.
+//
+// Like PoolIPBuilder.PoolIP, RangeMap reports accumulated errors
+// of invalid inputs and clears them. The returned RangeMap is usable
+// even if the error is non-nil.
+func (b *RangeMapBuilder) RangeMap() (*RangeMap, error) {
+	in := append([]rangeMapEntry{}, b.in...)
+	sort.SliceStable(in, func(i, j int) bool {
+		return in[i].r.from.Less(in[j].r.from)
+	})
+
+	// boundaries of elementary segments: starts and ends of ranges
+	points := make([]netip.Addr, 0, 2*len(in))
+	for _, e := range in {
+		points = append(points, e.r.from)
+		if next := e.r.to.Next(); next.IsValid() {
+			points = append(points, next)
+		}
+	}
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].Less(points[j])
+	})
+
+	m := &RangeMap{}
+	active := make([]rangeMapEntry, 0)
+	next := 0
+
+	for i, p := range points {
+		if i > 0 && p == points[i-1] {
+			continue
+		}
+
+		kept := active[:0]
+		for _, e := range active {
+			if !e.r.to.Less(p) {
+				kept = append(kept, e)
+			}
+		}
+		active = kept
+
+		for next < len(in) && in[next].r.from == p {
+			active = append(active, in[next])
+			next++
+		}
+		if len(active) == 0 {
+			continue
+		}
+
+		// segment ends before next boundary of its family,
+		// otherwise every active range ends at the family end
+		end := active[0].r.to
+		for j := i + 1; j < len(points); j++ {
+			if points[j] == p {
+				continue
+			}
+			if points[j].BitLen() == p.BitLen() {
+				end = points[j].Prev()
+			}
+			break
+		}
+
+		m.add(PoolRange{from: p, to: end}, b.resolve(active))
+	}
+
+	errs := b.errs
+	b.errs = nil
+	if len(errs) > 0 {
+		return m, errs
+	}
+	return m, nil
+}
+
+// resolve - returns value of segment covered by active entries
+func (b *RangeMapBuilder) resolve(active []rangeMapEntry) int {
+	if b.Resolve == nil {
+		return b.winner(active).v
+	}
+
+	ordered := append([]rangeMapEntry{}, active...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return b.prefers(ordered[i], ordered[j])
+	})
+	vs := make([]int, len(ordered))
+	for i, e := range ordered {
+		vs[i] = e.v
+	}
+	return b.Resolve(vs)
+}
+
+// winner - returns entry whose value is assigned by policy
+func (b *RangeMapBuilder) winner(active []rangeMapEntry) rangeMapEntry {
+	win := active[0]
+	for _, e := range active[1:] {
+		if b.prefers(e, win) {
+			win = e
+		}
+	}
+	return win
+}
+
+// prefers - reports whether policy assigns value of e over value of other
+func (b *RangeMapBuilder) prefers(e, other rangeMapEntry) bool {
+	if b.Policy == MostSpecificWins {
+		switch rangeSize(e.r).cmp(rangeSize(other.r)) {
+		case -1:
+			return true
+		case 1:
+			return false
+		}
+	}
+	return e.seq > other.seq
+}
+
+// rangeSize returns count of IPs in r minus one.
+func rangeSize(r PoolRange) uint128 {
+	return u128From16(r.to.As16()).sub(u128From16(r.from.As16()))
+}
+
+// RangeMap maps IP ranges to int values, usually indexes of
+// a table kept by the caller.
+//
+// RangeMap is not generic: the plugin is run by Yaegi, which
+// fails on methods of generic types.
+//
+// Ranges are sorted, not overlapping, and adjacent ranges
+// have different values.
+// RangeMap is safe for concurrent use.
+// The zero value is a valid empty map.
+// Use RangeMapBuilder to construct RangeMaps.
+type RangeMap struct {
+	rr []PoolRange
+	vv []int
+}
+
+// add appends r with v, merging it into the last range if it is
+// adjacent and has the same value.
+func (m *RangeMap) add(r PoolRange, v int) {
+	if n := len(m.rr); n > 0 && m.vv[n-1] == v && m.rr[n-1].to.Next() == r.from {
+		m.rr[n-1].to = r.to
+		return
+	}
+	m.rr = append(m.rr, r)
+	m.vv = append(m.vv, v)
+}
+
+// Lookup returns the value of ip and the range of m containing it.
+// If ip is not in m or has an IPv6 zone, Lookup returns ok=false.
+func (m *RangeMap) Lookup(ip netip.Addr) (v int, r PoolRange, ok bool) {
+	if ip.Zone() != "" {
+		return v, PoolRange{}, false
+	}
+	i := sort.Search(len(m.rr), func(i int) bool {
+		return ip.Less(m.rr[i].from)
+	}) - 1
+	if i < 0 || !m.rr[i].contains(ip) {
+		return v, PoolRange{}, false
+	}
+	return m.vv[i], m.rr[i], true
+}
+
+// Len returns the number of ranges in m.
+func (m *RangeMap) Len() int {
+	return len(m.rr)
+}
+
+// All calls yield for each range of m and its value in ascending
+// order, until yield returns false.
+// Its signature allows ranging over it: for r, v := range m.All.
+func (m *RangeMap) All(yield func(r PoolRange, v int) bool) {
+	for i, r := range m.rr {
+		if !yield(r, m.vv[i]) {
+			return
+		}
+	}
+}
+
+// PoolIP returns the set of IPs whose values are selected by keep.
+func (m *RangeMap) PoolIP(keep func(v int) bool) *PoolIP {
+	rr := make([]PoolRange, 0)
+	for i, r := range m.rr {
+		if !keep(m.vv[i]) {
+			continue
+		}
+		if n := len(rr); n > 0 && rr[n-1].to.Next() == r.from {
+			rr[n-1].to = r.to
+			continue
+		}
+		rr = append(rr, r)
+	}
+	return &PoolIP{rr: rr}
+}
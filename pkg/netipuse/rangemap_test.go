@@ -0,0 +1,346 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package netipuse
+
+import (
+	"fmt"
+	"math/rand"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+type rangeMapInput struct {
+	from, to string
+	v        int
+}
+
+func buildRangeMap(t *testing.T, policy OverlapPolicy, in []rangeMapInput) *RangeMap {
+	t.Helper()
+
+	b := RangeMapBuilder{Policy: policy}
+	for _, e := range in {
+		b.AddRange(PoolRangeFrom(netip.MustParseAddr(e.from), netip.MustParseAddr(e.to)), e.v)
+	}
+	m, err := b.RangeMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// dumpRangeMap returns ranges of m with values, checking RangeMap invariants.
+func dumpRangeMap(t *testing.T, m *RangeMap) string {
+	t.Helper()
+
+	var (
+		out  []string
+		prev PoolRange
+		pv   int
+	)
+	m.All(func(r PoolRange, v int) bool {
+		if len(out) > 0 {
+			if !prev.to.Less(r.from) {
+				t.Errorf("range %s is not after %s", r, prev)
+			}
+			if prev.to.Next() == r.from && pv == v {
+				t.Errorf("adjacent ranges %s and %s have equal value %d", prev, r, v)
+			}
+		}
+		out = append(out, fmt.Sprintf("%s=%d", r, v))
+		prev, pv = r, v
+		return true
+	})
+	if len(out) != m.Len() {
+		t.Errorf("All yields %d ranges, Len is %d", len(out), m.Len())
+	}
+	return strings.Join(out, " ")
+}
+
+func TestRangeMapPolicy(t *testing.T) {
+	tests := []struct {
+		name         string
+		in           []rangeMapInput
+		lastWins     string
+		mostSpecific string
+	}{
+		{
+			name: "nested, outer added last",
+			in: []rangeMapInput{
+				{"1.2.0.0", "1.2.255.255", 2},
+				{"1.0.0.0", "1.255.255.255", 1},
+			},
+			lastWins:     "1.0.0.0-1.255.255.255=1",
+			mostSpecific: "1.0.0.0-1.1.255.255=1 1.2.0.0-1.2.255.255=2 1.3.0.0-1.255.255.255=1",
+		},
+		{
+			name: "nested, inner added last",
+			in: []rangeMapInput{
+				{"2001:db8::", "2001:db8:ffff:ffff:ffff:ffff:ffff:ffff", 1},
+				{"2001:db8:1::", "2001:db8:1::ff", 2},
+			},
+			lastWins:     "2001:db8::-2001:db8:0:ffff:ffff:ffff:ffff:ffff=1 2001:db8:1::-2001:db8:1::ff=2 2001:db8:1::100-2001:db8:ffff:ffff:ffff:ffff:ffff:ffff=1",
+			mostSpecific: "2001:db8::-2001:db8:0:ffff:ffff:ffff:ffff:ffff=1 2001:db8:1::-2001:db8:1::ff=2 2001:db8:1::100-2001:db8:ffff:ffff:ffff:ffff:ffff:ffff=1",
+		},
+		{
+			name: "partial overlap, smaller range first",
+			in: []rangeMapInput{
+				{"10.0.0.0", "10.0.0.200", 1},
+				{"10.0.0.100", "10.0.1.255", 2},
+			},
+			lastWins:     "10.0.0.0-10.0.0.99=1 10.0.0.100-10.0.1.255=2",
+			mostSpecific: "10.0.0.0-10.0.0.200=1 10.0.0.201-10.0.1.255=2",
+		},
+		{
+			name: "equal size resolved as last wins",
+			in: []rangeMapInput{
+				{"10.0.0.0", "10.0.0.255", 1},
+				{"10.0.0.0", "10.0.0.255", 2},
+				{"10.0.0.128", "10.0.1.127", 3},
+			},
+			lastWins:     "10.0.0.0-10.0.0.127=2 10.0.0.128-10.0.1.127=3",
+			mostSpecific: "10.0.0.0-10.0.0.127=2 10.0.0.128-10.0.1.127=3",
+		},
+	}
+
+	for _, tt := range tests {
+		for _, p := range []struct {
+			policy OverlapPolicy
+			want   string
+		}{{LastWins, tt.lastWins}, {MostSpecificWins, tt.mostSpecific}} {
+			if got := dumpRangeMap(t, buildRangeMap(t, p.policy, tt.in)); got != p.want {
+				t.Errorf("%s, policy %d:\n got %s\nwant %s", tt.name, p.policy, got, p.want)
+			}
+		}
+	}
+}
+
+func TestRangeMapMerge(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []rangeMapInput
+		want string
+	}{
+		{
+			name: "adjacent equal values",
+			in: []rangeMapInput{
+				{"1.0.1.0", "1.0.1.255", 7},
+				{"1.0.0.0", "1.0.0.255", 7},
+				{"1.0.2.0", "1.0.2.255", 8},
+			},
+			want: "1.0.0.0-1.0.1.255=7 1.0.2.0-1.0.2.255=8",
+		},
+		{
+			name: "nested equal values",
+			in: []rangeMapInput{
+				{"1.0.0.0", "1.0.3.255", 7},
+				{"1.0.1.0", "1.0.1.255", 7},
+			},
+			want: "1.0.0.0-1.0.3.255=7",
+		},
+		{
+			name: "not adjacent equal values",
+			in: []rangeMapInput{
+				{"1.0.0.0", "1.0.0.255", 7},
+				{"1.0.2.0", "1.0.2.255", 7},
+			},
+			want: "1.0.0.0-1.0.0.255=7 1.0.2.0-1.0.2.255=7",
+		},
+		{
+			name: "families are not merged",
+			in: []rangeMapInput{
+				{"255.255.255.0", "255.255.255.255", 7},
+				{"::", "::ff", 7},
+			},
+			want: "255.255.255.0-255.255.255.255=7 ::-::ff=7",
+		},
+		{
+			name: "whole address spaces",
+			in: []rangeMapInput{
+				{"::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", 7},
+				{"0.0.0.0", "255.255.255.255", 7},
+			},
+			want: "0.0.0.0-255.255.255.255=7 ::-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff=7",
+		},
+	}
+
+	for _, tt := range tests {
+		for _, policy := range []OverlapPolicy{LastWins, MostSpecificWins} {
+			if got := dumpRangeMap(t, buildRangeMap(t, policy, tt.in)); got != tt.want {
+				t.Errorf("%s, policy %d:\n got %s\nwant %s", tt.name, policy, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestRangeMapLookup(t *testing.T) {
+	m := buildRangeMap(t, MostSpecificWins, []rangeMapInput{
+		{"0.0.0.0", "255.255.255.255", 1},
+		{"0.0.0.0", "0.0.0.0", 2},
+		{"255.255.255.255", "255.255.255.255", 3},
+		{"::", "::", 4},
+		{"ffff::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", 5},
+	})
+
+	tests := []struct {
+		ip string
+		v  int
+		r  string
+		ok bool
+	}{
+		{"0.0.0.0", 2, "0.0.0.0-0.0.0.0", true},
+		{"0.0.0.1", 1, "0.0.0.1-255.255.255.254", true},
+		{"255.255.255.254", 1, "0.0.0.1-255.255.255.254", true},
+		{"255.255.255.255", 3, "255.255.255.255-255.255.255.255", true},
+		{"::", 4, "::-::", true},
+		{"::1", 0, "", false},
+		{"::ffff:1.2.3.4", 0, "", false},
+		{"fffe:ffff:ffff:ffff:ffff:ffff:ffff:ffff", 0, "", false},
+		{"ffff::", 5, "ffff::-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", true},
+		{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", 5, "ffff::-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", true},
+		{"fe80::1%eth0", 0, "", false},
+	}
+
+	for _, tt := range tests {
+		v, r, ok := m.Lookup(netip.MustParseAddr(tt.ip))
+		if v != tt.v || ok != tt.ok || (ok && r.String() != tt.r) {
+			t.Errorf("Lookup(%s) = %d, %s, %v, want %d, %s, %v", tt.ip, v, r, ok, tt.v, tt.r, tt.ok)
+		}
+	}
+
+	// All stops when yield returns false
+	n := 0
+	m.All(func(PoolRange, int) bool {
+		n++
+		return n < 2
+	})
+	if n != 2 {
+		t.Errorf("All yields %d ranges after stop", n)
+	}
+
+	rr := m.PoolIP(func(v int) bool { return v == 1 || v == 3 }).Ranges()
+	if len(rr) != 1 || rr[0].String() != "0.0.0.1-255.255.255.255" {
+		t.Errorf("PoolIP = %v, want adjacent ranges merged", rr)
+	}
+}
+
+func TestRangeMapEmpty(t *testing.T) {
+	built, err := (&RangeMapBuilder{}).RangeMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range []*RangeMap{{}, built} {
+		if m.Len() != 0 {
+			t.Errorf("empty map Len = %d", m.Len())
+		}
+		for _, s := range []string{"0.0.0.0", "255.255.255.255", "::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"} {
+			if v, _, ok := m.Lookup(netip.MustParseAddr(s)); ok || v != 0 {
+				t.Errorf("empty map Lookup(%s) = %d, %v", s, v, ok)
+			}
+		}
+		m.All(func(r PoolRange, v int) bool {
+			t.Errorf("empty map yields %s", r)
+			return true
+		})
+		if !m.PoolIP(func(int) bool { return true }).IsEmpty() {
+			t.Error("empty map PoolIP is not empty")
+		}
+	}
+}
+
+func TestRangeMapResolve(t *testing.T) {
+	var calls []string
+	b := RangeMapBuilder{
+		Policy: MostSpecificWins,
+		Resolve: func(vs []int) int {
+			calls = append(calls, fmt.Sprint(vs))
+			return vs[len(vs)-1]
+		},
+	}
+	b.AddPrefix(netip.MustParsePrefix("10.0.0.0/8"), 1)
+	b.AddPrefix(netip.MustParsePrefix("10.1.0.0/16"), 2)
+	b.AddPrefix(netip.MustParsePrefix("10.1.1.0/24"), 3)
+	b.AddPrefix(netip.Prefix{}, 4)
+
+	m, err := b.RangeMap()
+	if err == nil {
+		t.Error("RangeMap of invalid prefix returns no error")
+	}
+
+	// values are ordered by policy, the winner first
+	want := "[1] [2 1] [3 2 1] [2 1] [1]"
+	if got := strings.Join(calls, " "); got != want {
+		t.Errorf("Resolve calls = %s, want %s", got, want)
+	}
+	if got := dumpRangeMap(t, m); got != "10.0.0.0-10.255.255.255=1" {
+		t.Errorf("resolved map = %s", got)
+	}
+}
+
+// TestRangeMapRandom compares lookups with values computed from
+// the added ranges directly.
+func TestRangeMapRandom(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	bases := []netip.Addr{
+		netip.MustParseAddr("10.0.0.0"),
+		netip.MustParseAddr("255.255.255.0"),
+		netip.MustParseAddr("::"),
+	}
+
+	for i := 0; i < 200; i++ {
+		base := bases[i%len(bases)]
+		policy := OverlapPolicy(i % 2)
+
+		var in []rangeMapInput
+		b := RangeMapBuilder{Policy: policy}
+		for n := 1 + rnd.Intn(8); n > 0; n-- {
+			from := addrAdd(base, rnd.Intn(200))
+			to := addrAdd(from, rnd.Intn(56))
+			if !to.IsValid() {
+				to = from
+			}
+			in = append(in, rangeMapInput{from.String(), to.String(), rnd.Intn(3)})
+			b.AddRange(PoolRangeFrom(from, to), in[len(in)-1].v)
+		}
+		m, err := b.RangeMap()
+		if err != nil {
+			t.Fatal(err)
+		}
+		dumpRangeMap(t, m)
+
+		for ip, k := base.Prev(), 0; k < 258 && (k == 0 || ip.IsValid()); ip, k = ip.Next(), k+1 {
+			if !ip.IsValid() {
+				continue
+			}
+			want, wantOK := refRangeMapValue(in, policy, ip)
+			v, r, ok := m.Lookup(ip)
+			if ok != wantOK || v != want || (ok && !r.Contains(ip)) {
+				t.Fatalf("policy %d, ranges %v: Lookup(%s) = %d, %s, %v, want %d, %v",
+					policy, in, ip, v, r, ok, want, wantOK)
+			}
+		}
+	}
+}
+
+// refRangeMapValue returns value of ip by policy over all added ranges.
+func refRangeMapValue(in []rangeMapInput, policy OverlapPolicy, ip netip.Addr) (int, bool) {
+	var (
+		win   PoolRange
+		v     int
+		found bool
+	)
+	for _, e := range in {
+		r := PoolRangeFrom(netip.MustParseAddr(e.from), netip.MustParseAddr(e.to))
+		if !r.Contains(ip) {
+			continue
+		}
+		if found && policy == MostSpecificWins && rangeSize(r).cmp(rangeSize(win)) > 0 {
+			continue
+		}
+		win, v, found = r, e.v, true
+	}
+	return v, found
+}
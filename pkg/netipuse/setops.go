@@ -0,0 +1,177 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package netipuse
+
+import (
+	"math/big"
+	"net/netip"
+)
+
+// Set operations below merge the sorted, normalized ranges of both
+// sets in one pass, in O(n+m), and return sets normalized the same way
+// as PoolIPBuilder.PoolIP does. Results use the lookup layout of s.
+
+// Union returns the set of IPs in s or in o.
+func (s *PoolIP) Union(o *PoolIP) *PoolIP {
+	return s.withRanges(unionRanges(s.rr, o.rr))
+}
+
+// Intersection returns the set of IPs in both s and o.
+func (s *PoolIP) Intersection(o *PoolIP) *PoolIP {
+	out := make([]PoolRange, 0)
+	i, j := 0, 0
+	for i < len(s.rr) && j < len(o.rr) {
+		a, b := s.rr[i], o.rr[j]
+
+		from, to := a.from, a.to
+		if from.Less(b.from) {
+			from = b.from
+		}
+		if b.to.Less(to) {
+			to = b.to
+		}
+		if !to.Less(from) {
+			out = append(out, PoolRange{from: from, to: to})
+		}
+
+		if a.to.Less(b.to) {
+			i++
+		} else {
+			j++
+		}
+	}
+	return s.withRanges(out)
+}
+
+// Difference returns the set of IPs in s but not in o.
+func (s *PoolIP) Difference(o *PoolIP) *PoolIP {
+	return s.withRanges(differenceRanges(s.rr, o.rr))
+}
+
+// SymmetricDifference returns the set of IPs in exactly one of s and o.
+func (s *PoolIP) SymmetricDifference(o *PoolIP) *PoolIP {
+	return s.withRanges(unionRanges(
+		differenceRanges(s.rr, o.rr),
+		differenceRanges(o.rr, s.rr),
+	))
+}
+
+// IsEmpty reports whether s contains no IPs.
+func (s *PoolIP) IsEmpty() bool {
+	return len(s.rr) == 0
+}
+
+// Size returns the number of IPv4 and IPv6 addresses in s.
+// IPv6 count may exceed 128 bits, so it is returned as big.Int.
+func (s *PoolIP) Size() (ipv4 uint64, ipv6 *big.Int) {
+	ipv6 = new(big.Int)
+	one := big.NewInt(1)
+	for _, r := range s.rr {
+		if r.from.Is4() {
+			ipv4 += uint64(u32From4(r.to)-u32From4(r.from)) + 1
+			continue
+		}
+		n := rangeSize(r)
+		size := new(big.Int).SetUint64(n.hi)
+		size.Lsh(size, 64)
+		size.Or(size, new(big.Int).SetUint64(n.lo))
+		ipv6.Add(ipv6, size.Add(size, one))
+	}
+	return ipv4, ipv6
+}
+
+// AllRanges calls yield for each range of s in ascending order,
+// until yield returns false.
+// Its signature allows ranging over it: for r := range s.AllRanges.
+func (s *PoolIP) AllRanges(yield func(r PoolRange) bool) {
+	for _, r := range s.rr {
+		if !yield(r) {
+			return
+		}
+	}
+}
+
+// AllPrefixes calls yield for each prefix of the minimal prefix
+// cover of s in ascending order, until yield returns false.
+// Unlike Prefixes, it does not allocate the whole list.
+func (s *PoolIP) AllPrefixes(yield func(p netip.Prefix) bool) {
+	var buf []netip.Prefix
+	for _, r := range s.rr {
+		buf = r.AppendPrefixes(buf[:0])
+		for _, p := range buf {
+			if !yield(p) {
+				return
+			}
+		}
+	}
+}
+
+// withRanges returns a set of normalized rr with the lookup layout of s.
+func (s *PoolIP) withRanges(rr []PoolRange) *PoolIP {
+	return (&PoolIP{rr: rr}).WithLayout(s.Layout())
+}
+
+// unionRanges merges two normalized range lists.
+func unionRanges(a, b []PoolRange) []PoolRange {
+	out := make([]PoolRange, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		var r PoolRange
+		if j == len(b) || (i < len(a) && a[i].from.Less(b[j].from)) {
+			r = a[i]
+			i++
+		} else {
+			r = b[j]
+			j++
+		}
+		out = appendMerged(out, r)
+	}
+	return out
+}
+
+// appendMerged appends r to sorted out, merging it into the last
+// range if they overlap or are adjacent.
+func appendMerged(out []PoolRange, r PoolRange) []PoolRange {
+	n := len(out)
+	if n == 0 {
+		return append(out, r)
+	}
+	last := &out[n-1]
+	if last.to.Less(r.from) && last.to.Next() != r.from {
+		return append(out, r)
+	}
+	if last.to.Less(r.to) {
+		last.to = r.to
+	}
+	return out
+}
+
+// differenceRanges returns ranges of a not covered by b.
+func differenceRanges(a, b []PoolRange) []PoolRange {
+	out := make([]PoolRange, 0, len(a))
+	j := 0
+	for _, r := range a {
+		// skip ranges of b ending before r
+		for j < len(b) && b[j].to.Less(r.from) {
+			j++
+		}
+
+		cur, empty := r, false
+		for k := j; k < len(b) && !cur.to.Less(b[k].from); k++ {
+			if cur.from.Less(b[k].from) {
+				out = append(out, PoolRange{from: cur.from, to: b[k].from.Prev()})
+			}
+			if !b[k].to.Less(cur.to) {
+				empty = true
+				break
+			}
+			cur.from = b[k].to.Next()
+		}
+		if !empty {
+			out = append(out, cur)
+		}
+	}
+	return out
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package netipuse
+
+import (
+	"math/rand"
+	"net/netip"
+	"testing"
+)
+
+// randomPool returns a set of random ranges near base, so sets of
+// the same base overlap, touch and nest each other often.
+func randomPool(t *testing.T, rnd *rand.Rand, base netip.Addr) *PoolIP {
+	t.Helper()
+
+	var b PoolIPBuilder
+	for n := rnd.Intn(8); n > 0; n-- {
+		from := addrAdd(base, rnd.Intn(256))
+		to := addrAdd(from, rnd.Intn(32))
+		if rnd.Intn(4) == 0 {
+			b.RemoveRange(PoolRangeFrom(from, to))
+			continue
+		}
+		b.AddRange(PoolRangeFrom(from, to))
+	}
+
+	s, err := b.PoolIP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func addrAdd(ip netip.Addr, n int) netip.Addr {
+	for ; n > 0; n-- {
+		ip = ip.Next()
+	}
+	return ip
+}
+
+// reference results of set operations computed by PoolIPBuilder
+func refUnion(a, b *PoolIP) *PoolIP {
+	var s PoolIPBuilder
+	s.AddSet(a)
+	s.AddSet(b)
+	ret, _ := s.PoolIP()
+	return ret
+}
+
+func refIntersection(a, b *PoolIP) *PoolIP {
+	var s PoolIPBuilder
+	s.AddSet(a)
+	s.Intersect(b)
+	ret, _ := s.PoolIP()
+	return ret
+}
+
+func refDifference(a, b *PoolIP) *PoolIP {
+	var s PoolIPBuilder
+	s.AddSet(a)
+	s.RemoveSet(b)
+	ret, _ := s.PoolIP()
+	return ret
+}
+
+func refSymmetricDifference(a, b *PoolIP) *PoolIP {
+	var s PoolIPBuilder
+	s.AddSet(refUnion(a, b))
+	s.RemoveSet(refIntersection(a, b))
+	ret, _ := s.PoolIP()
+	return ret
+}
+
+func TestSetOpsMatchBuilder(t *testing.T) {
+	bases := []struct {
+		name string
+		base []netip.Addr
+	}{
+		{"ipv4", []netip.Addr{netip.MustParseAddr("10.0.0.0")}},
+		{"ipv6", []netip.Addr{netip.MustParseAddr("2001:db8::")}},
+		{"ipv4-end", []netip.Addr{netip.MustParseAddr("255.255.254.224")}},
+		{"mixed", []netip.Addr{netip.MustParseAddr("192.0.2.0"), netip.MustParseAddr("2001:db8::ff00")}},
+	}
+
+	ops := []struct {
+		name string
+		op   func(a, b *PoolIP) *PoolIP
+		ref  func(a, b *PoolIP) *PoolIP
+	}{
+		{"Union", (*PoolIP).Union, refUnion},
+		{"Intersection", (*PoolIP).Intersection, refIntersection},
+		{"Difference", (*PoolIP).Difference, refDifference},
+		{"SymmetricDifference", (*PoolIP).SymmetricDifference, refSymmetricDifference},
+	}
+
+	for _, tt := range bases {
+		t.Run(tt.name, func(t *testing.T) {
+			rnd := rand.New(rand.NewSource(1))
+			for i := 0; i < 2000; i++ {
+				base := tt.base[rnd.Intn(len(tt.base))]
+				a := randomPool(t, rnd, base).Union(randomPool(t, rnd, tt.base[0]))
+				b := randomPool(t, rnd, base)
+				if rnd.Intn(2) == 0 {
+					a = a.WithLayout(LayoutFlat)
+				}
+
+				for _, op := range ops {
+					got, want := op.op(a, b), op.ref(a, b)
+					if !got.Equal(want) {
+						t.Fatalf("%s(%v, %v) = %v, want %v", op.name, a.Ranges(), b.Ranges(), got.Ranges(), want.Ranges())
+					}
+					if got.Layout() != a.Layout() {
+						t.Fatalf("%s layout = %v, want %v", op.name, got.Layout(), a.Layout())
+					}
+				}
+
+				if got, want := a.Overlaps(b), !refIntersection(a, b).IsEmpty(); got != want {
+					t.Fatalf("Overlaps(%v, %v) = %v, want %v", a.Ranges(), b.Ranges(), got, want)
+				}
+				if got, want := b.Overlaps(a), a.Overlaps(b); got != want {
+					t.Fatalf("Overlaps(%v, %v) is not symmetric", a.Ranges(), b.Ranges())
+				}
+			}
+		})
+	}
+}
+
+func TestSetOpsEmpty(t *testing.T) {
+	empty := &PoolIP{}
+	s := randomPool(t, rand.New(rand.NewSource(2)), netip.MustParseAddr("10.0.0.0"))
+
+	if !s.Union(empty).Equal(s) || !empty.Union(s).Equal(s) {
+		t.Error("Union with empty set changes set")
+	}
+	if !s.Intersection(empty).IsEmpty() || !empty.Intersection(s).IsEmpty() {
+		t.Error("Intersection with empty set is not empty")
+	}
+	if !s.Difference(empty).Equal(s) || !empty.Difference(s).IsEmpty() {
+		t.Error("Difference with empty set is wrong")
+	}
+	if !s.SymmetricDifference(s).IsEmpty() {
+		t.Error("SymmetricDifference of set with itself is not empty")
+	}
+	if s.Overlaps(empty) || empty.Overlaps(s) {
+		t.Error("empty set overlaps set")
+	}
+}
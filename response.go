@@ -0,0 +1,148 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package geo_filt
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/eterline/geo-filt/internal/service/filter"
+)
+
+const (
+	defaultRejectBody = "403 Forbidden - Invalid request region"
+
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// rejectResponse - response for denied requests
+type rejectResponse struct {
+	status       int
+	body         string
+	contentType  string
+	format       string
+	headers      map[string]string
+	redirectURL  string
+	redirectCode int
+}
+
+func newRejectResponse(c *Config) (*rejectResponse, error) {
+	rr := &rejectResponse{
+		status:       c.StatusCode,
+		body:         c.Body,
+		contentType:  c.ContentType,
+		format:       strings.ToLower(c.ResponseFormat),
+		headers:      c.ResponseHeaders,
+		redirectURL:  c.RedirectURL,
+		redirectCode: c.RedirectCode,
+	}
+
+	if rr.status == 0 {
+		rr.status = http.StatusForbidden
+	}
+	if rr.status < 400 || rr.status > 599 {
+		return nil, fmt.Errorf("invalid statusCode: %d, must be 4xx or 5xx", rr.status)
+	}
+
+	if rr.body == "" {
+		rr.body = defaultRejectBody
+	}
+
+	switch rr.format {
+	case "":
+		rr.format = formatText
+	case formatText, formatJSON:
+	default:
+		return nil, fmt.Errorf("invalid responseFormat: %q, must be text or json", c.ResponseFormat)
+	}
+
+	if rr.contentType == "" {
+		rr.contentType = "text/plain; charset=utf-8"
+		if rr.format == formatJSON {
+			rr.contentType = "application/json"
+		}
+	}
+
+	if rr.redirectURL != "" {
+		if _, err := url.Parse(rr.redirectURL); err != nil {
+			return nil, fmt.Errorf("invalid redirectURL: %w", err)
+		}
+		if rr.redirectCode == 0 {
+			rr.redirectCode = http.StatusFound
+		}
+		switch rr.redirectCode {
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+			http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		default:
+			return nil, fmt.Errorf("invalid redirectCode: %d, must be 301, 302, 303, 307 or 308", rr.redirectCode)
+		}
+	}
+
+	return rr, nil
+}
+
+// placeholders - returns replacer of {ip}, {country} and {provider} template placeholders
+func placeholders(ip netip.Addr, d filter.Decision, escape func(string) string) *strings.Replacer {
+	addr := ""
+	if ip.IsValid() {
+		addr = ip.String()
+	}
+	return strings.NewReplacer(
+		"{ip}", escape(addr),
+		"{country}", escape(d.Country),
+		"{provider}", escape(d.Provider),
+	)
+}
+
+func (rr *rejectResponse) write(rw http.ResponseWriter, req *http.Request, ip netip.Addr, d filter.Decision) {
+	for k, v := range rr.headers {
+		rw.Header().Set(k, v)
+	}
+
+	if rr.redirectURL != "" {
+		target := placeholders(ip, d, url.QueryEscape).Replace(rr.redirectURL)
+		http.Redirect(rw, req, target, rr.redirectCode)
+		return
+	}
+
+	body := placeholders(ip, d, func(s string) string { return s }).Replace(rr.body)
+
+	if rr.format == formatJSON {
+		payload := struct {
+			Status   int    `json:"status"`
+			Error    string `json:"error"`
+			IP       string `json:"ip,omitempty"`
+			Country  string `json:"country,omitempty"`
+			Provider string `json:"provider,omitempty"`
+		}{
+			Status:   rr.status,
+			Error:    body,
+			Country:  d.Country,
+			Provider: d.Provider,
+		}
+		if ip.IsValid() {
+			payload.IP = ip.String()
+		}
+
+		b, err := json.Marshal(payload)
+		if err != nil {
+			http.Error(rw, defaultRejectBody, rr.status)
+			return
+		}
+		body = string(b)
+	}
+
+	rw.Header().Set("Content-Type", rr.contentType)
+	rw.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	rw.Header().Set("X-Content-Type-Options", "nosniff")
+	rw.WriteHeader(rr.status)
+	rw.Write([]byte(body))
+}
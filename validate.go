@@ -0,0 +1,202 @@
+// Copyright (c) 2025 EterLine (Andrew)
+// This file is part of geo-filt.
+// Licensed under the GNU AFFERO GENERAL PUBLIC LICENSE. See the LICENSE file for details.
+
+package geo_filt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/eterline/geo-filt/internal/adapter/ipmatch"
+	"github.com/eterline/geo-filt/internal/service/bypass"
+)
+
+// Problem - config issue found by validation
+type Problem struct {
+	Option  string // config option name
+	Value   string // invalid entry of option, empty if option is invalid as a whole
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Value == "" {
+		return p.Option + ": " + p.Message
+	}
+	return fmt.Sprintf("%s: %q: %s", p.Option, p.Value, p.Message)
+}
+
+// Problems - config issues, error of plugin start in strict mode
+type Problems []Problem
+
+func (ps Problems) Error() string {
+	ss := make([]string, 0, len(ps))
+	for _, p := range ps {
+		ss = append(ss, p.String())
+	}
+	return fmt.Sprintf("invalid config, %d problems: %s", len(ps), strings.Join(ss, "; "))
+}
+
+func (ps *Problems) add(option, value, format string, args ...any) {
+	*ps = append(*ps, Problem{Option: option, Value: value, Message: fmt.Sprintf(format, args...)})
+}
+
+/*
+Validate - checks config options without loading datasets.
+
+	Reports invalid and non-canonical defined entries, invalid tags
+	and autonomous systems, partially configured geo and ASN blocks.
+	Tags are resolved against geo source by NewFilter.
+*/
+func (c Config) Validate() Problems {
+	ps := Problems{}
+
+	ps.defined("defined", c.Defined)
+	ps.defined("denyDefined", c.DenyDefined)
+	ps.defined("trustedProxies", c.TrustedProxies)
+	if c.HeaderBearer && !c.trustedExists() {
+		ps.add("headerBearer", "", "trustedProxies is empty, client IP headers are ignored")
+	}
+
+	ps.tags("tags", c.Tags)
+	ps.tags("denyTags", c.DenyTags)
+
+	ps.asns("asn", c.Asn)
+	ps.asns("denyAsn", c.DenyAsn)
+
+	c.validateGeo(&ps)
+	c.validateASN(&ps)
+	c.validateBypass(&ps)
+
+	return ps
+}
+
+// defined - checks IPs and subnets strings
+func (ps *Problems) defined(option string, subnets []string) {
+	for _, s := range subnets {
+		p, err := ipmatch.ParseDefined(s)
+		if err != nil {
+			ps.add(option, s, "not an IP or subnet, entry is ignored")
+			continue
+		}
+		if m := p.Masked(); m != p {
+			ps.add(option, s, "non-canonical prefix, host bits are ignored: network is %s", m)
+		}
+	}
+}
+
+// tags - checks tag selectors syntax
+func (ps *Problems) tags(option string, tags []string) {
+	for _, tag := range tags {
+		if _, err := ipmatch.ParseTags([]string{tag}); err != nil {
+			ps.add(option, tag, "unknown tag: %v", err)
+		}
+	}
+}
+
+// asns - checks autonomous system numbers syntax
+func (ps *Problems) asns(option string, asns []string) {
+	for _, s := range asns {
+		if _, err := ipmatch.ParseASN(s); err != nil {
+			ps.add(option, s, "not an autonomous system number")
+		}
+	}
+}
+
+// geoSourceOptions - geo source options by priority
+func (c Config) geoSourceOptions() []string {
+	opts := make([]string, 0, 4)
+	if c.SnapshotFile != "" {
+		opts = append(opts, "snapshotFile")
+	}
+	if c.MMDBFile != "" {
+		opts = append(opts, "mmdbFile")
+	}
+	if c.DatFile != "" {
+		opts = append(opts, "datFile")
+	}
+	if c.CodeFile != "" && len(c.GeoFile) > 0 {
+		opts = append(opts, "codeFile")
+	}
+	return opts
+}
+
+// validateGeo - reports geo blocks disabled by missing options and ignored sources
+func (c Config) validateGeo(ps *Problems) {
+	if c.CodeFile != "" && len(c.GeoFile) == 0 {
+		ps.add("codeFile", "", "geoFile is not set, CSV geo source is disabled")
+	}
+	if len(c.GeoFile) > 0 && c.CodeFile == "" {
+		ps.add("geoFile", "", "codeFile is not set, CSV geo source is disabled")
+	}
+
+	opts := c.geoSourceOptions()
+	if len(opts) > 1 {
+		for _, opt := range opts[1:] {
+			ps.add(opt, "", "ignored, geo source %s is used", opts[0])
+		}
+	}
+
+	if !c.geoSourceExists() {
+		const msg = "geo source is not set (codeFile with geoFile, mmdbFile, datFile or snapshotFile), geo filtering is disabled"
+		if len(c.Tags) > 0 {
+			ps.add("tags", "", msg)
+		}
+		if len(c.DenyTags) > 0 {
+			ps.add("denyTags", "", msg)
+		}
+		return
+	}
+
+	if len(c.Tags) == 0 && len(c.DenyTags) == 0 {
+		ps.add(opts[0], "", "tags and denyTags are empty, geo source is not used")
+	}
+}
+
+// validateASN - reports ASN blocks disabled by missing options
+func (c Config) validateASN(ps *Problems) {
+	listed := len(c.Asn) > 0 || len(c.DenyAsn) > 0
+	switch {
+	case listed && len(c.AsnFile) == 0:
+		ps.add("asnFile", "", "not set, asn and denyAsn are ignored")
+	case !listed && len(c.AsnFile) > 0:
+		ps.add("asnFile", "", "asn and denyAsn are empty, ASN files are not used")
+	}
+}
+
+// validateBypass - reports bypass options disabled by missing credentials
+func (c Config) validateBypass(ps *Problems) {
+	if c.BypassCookie != "" && !c.bypassExists() {
+		ps.add("bypassCookie", "", "bypassSecret and bypassKeys are empty, bypass is disabled")
+	}
+	if c.BypassSecret != "" {
+		if _, err := bypass.NewVerifier(c.BypassSecret, nil); err != nil {
+			ps.add("bypassSecret", "", "%v", err)
+		}
+	}
+	// keys are secrets too, they are reported by position
+	for i, key := range c.BypassKeys {
+		if _, err := bypass.NewVerifier("", []string{key}); err != nil {
+			ps.add("bypassKeys", "", "entry %d is invalid: subject:key or key expected", i+1)
+		}
+	}
+}
+
+// validateTags - reports tags matching no location or no network of geo source
+func (c Config) validateTags(ps *Problems, gi *ipmatch.GeoIndex) {
+	check := func(option string, tags []string) {
+		for _, tag := range tags {
+			locations, pool, err := gi.ResolveTag(tag)
+			switch {
+			case err != nil:
+				// syntax is reported by Validate
+			case locations == 0:
+				ps.add(option, tag, "unknown tag, no location of geo source matches it")
+			case pool.IsEmpty():
+				ps.add(option, tag, "tag resolved to zero networks")
+			}
+		}
+	}
+	check("tags", c.Tags)
+	check("denyTags", c.DenyTags)
+}